@@ -0,0 +1,23 @@
+package authkratosctx
+
+import "context"
+
+// UserInfo 认证通过的用户信息，各个认证中间件和业务代码共用同一个上下文 key，避免 key 冲突
+type UserInfo struct {
+	Username string
+	UserID   string
+	Roles    []string
+	Metadata map[string]string
+}
+
+type userInfoKey struct{}
+
+func SetUserInfoIntoContext(ctx context.Context, userInfo UserInfo) context.Context {
+	return context.WithValue(ctx, userInfoKey{}, userInfo)
+}
+
+// GetUserInfo 在 handler 里获取认证通过的用户信息
+func GetUserInfo(ctx context.Context) (UserInfo, bool) {
+	userInfo, ok := ctx.Value(userInfoKey{}).(UserInfo)
+	return userInfo, ok
+}
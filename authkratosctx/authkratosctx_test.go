@@ -0,0 +1,30 @@
+package authkratosctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestGetUserInfo(t *testing.T) {
+	_, ok := GetUserInfo(context.Background())
+	require.False(t, ok)
+
+	ctx := SetUserInfoIntoContext(context.Background(), UserInfo{
+		Username: "alice",
+		UserID:   "1",
+		Roles:    []string{"admin"},
+		Metadata: map[string]string{"tenant": "t1"},
+	})
+	userInfo, ok := GetUserInfo(ctx)
+	require.True(t, ok)
+	require.Equal(t, "alice", userInfo.Username)
+	require.Equal(t, "1", userInfo.UserID)
+	require.Equal(t, []string{"admin"}, userInfo.Roles)
+	require.Equal(t, "t1", userInfo.Metadata["tenant"])
+}
@@ -0,0 +1,250 @@
+package authkratoshash
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+	"go.elastic.co/apm/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Config 校验请求的 HMAC-SHA256 签名，适合服务之间调用，签名和请求内容绑定因此比固定的 token 更安全
+// 签名的内容是 method + "\n" + operation + "\n" + hex(sha256(body)) + "\n" + timestamp，调用方可以用 Sign 计算
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	secret            []byte
+	signatureHeader   string
+	timestampHeader   string
+	maxAge            time.Duration
+	nonceHeader       string
+	nonceStore        NonceStore
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher, secret []byte) *Config {
+	must.Have(secret)
+	return &Config{
+		selectPath:      selectPath,
+		secret:          secret,
+		signatureHeader: "X-Signature",
+		timestampHeader: "X-Timestamp",
+		maxAge:          5 * time.Minute,
+		enable:          true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印签名校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithSignatureHeader 设置签名的请求头，默认是 X-Signature
+func (a *Config) WithSignatureHeader(name string) *Config {
+	a.signatureHeader = name
+	return a
+}
+
+// WithTimestampHeader 设置时间戳的请求头，默认是 X-Timestamp，值是 unix 秒数
+func (a *Config) WithTimestampHeader(name string) *Config {
+	a.timestampHeader = name
+	return a
+}
+
+// WithMaxAge 设置签名的有效期，时间戳和服务器时间相差超过这个时长时拒绝，默认是5分钟
+func (a *Config) WithMaxAge(d time.Duration) *Config {
+	must.TRUE(d > 0)
+	a.maxAge = d
+	return a
+}
+
+// Sign 计算签名，调用方和中间件使用相同的算法，body 是请求内容，用 BodyBytes 得到
+func Sign(secret []byte, method string, operation string, body []byte, timestamp string) string {
+	bodyHash := sha256.Sum256(body)
+	return computeMac(secret, method+"\n"+operation+"\n"+hex.EncodeToString(bodyHash[:])+"\n"+timestamp)
+}
+
+// SignWithNonce 计算带 nonce 的签名，配置了 WithNonceHeader 时使用，签名内容是在 Sign 的基础上再加 "\n" + nonce
+func SignWithNonce(secret []byte, method string, operation string, body []byte, timestamp string, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+	return computeMac(secret, method+"\n"+operation+"\n"+hex.EncodeToString(bodyHash[:])+"\n"+timestamp+"\n"+nonce)
+}
+
+func computeMac(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BodyBytes 返回参与签名的请求内容，proto 消息使用确定性的序列化，[]byte 直接使用，其它类型使用 json
+// 中间件拿到的 req 已经是解码以后的对象，因此按对象重新序列化而不是读取原始的 body
+func BodyBytes(req interface{}) ([]byte, error) {
+	switch value := req.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return value, nil
+	case proto.Message:
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(value)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return data, nil
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return data, nil
+	}
+}
+
+// GetMethod 返回参与签名的 method，http 请求是请求的 method，grpc 请求是 "GRPC"
+func GetMethod(tp transport.Transporter) string {
+	if htp, ok := tp.(http.Transporter); ok && htp.Request() != nil {
+		return htp.Request().Method
+	}
+	return "GRPC"
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_hash middleware enable=%v signature_header=%v timestamp_header=%v max_age=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.signatureHeader,
+		cfg.timestampHeader,
+		cfg.maxAge,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+	if cfg.nonceHeader != "" {
+		must.Full(cfg.nonceStore)
+	}
+
+	return selector.Server(structlog.Wrap("auth_kratos_hash", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must check sign", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip check sign", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_hash: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				apmTx := apm.TransactionFromContext(ctx)
+				sp := apmTx.StartSpan("auth_kratos_hash", "auth", nil)
+				defer sp.End()
+
+				if erk := checkSignature(cfg, tp, req, LOG); erk != nil {
+					return nil, erk
+				}
+				return handleFunc(ctx, req)
+			}
+			return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: wrong context for middleware")
+		}
+	}
+}
+
+func checkSignature(cfg *Config, tp transport.Transporter, req interface{}, LOG *log.Helper) *errors.Error {
+	signature := tp.RequestHeader().Get(cfg.signatureHeader)
+	if signature == "" {
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: signature is missing")
+	}
+	timestamp := tp.RequestHeader().Get(cfg.timestampHeader)
+	if timestamp == "" {
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: timestamp is missing")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: timestamp is wrong")
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > cfg.maxAge || age < -cfg.maxAge {
+		LOG.Infof("auth_kratos_hash: operation=%s timestamp=%v expired", tp.Operation(), timestamp)
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: timestamp is expired")
+	}
+	body, err := BodyBytes(req)
+	if err != nil {
+		LOG.Warnf("auth_kratos_hash: operation=%s read body error=%v", tp.Operation(), err)
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: body is wrong")
+	}
+	if cfg.nonceHeader == "" {
+		expected := Sign(cfg.secret, GetMethod(tp), tp.Operation(), body, timestamp)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+			LOG.Infof("auth_kratos_hash: operation=%s signature mismatch", tp.Operation())
+			return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: signature is wrong")
+		}
+		return nil
+	}
+	nonce := tp.RequestHeader().Get(cfg.nonceHeader)
+	if nonce == "" {
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: nonce is missing")
+	}
+	expected := SignWithNonce(cfg.secret, GetMethod(tp), tp.Operation(), body, timestamp, nonce)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		LOG.Infof("auth_kratos_hash: operation=%s signature mismatch", tp.Operation())
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: signature is wrong")
+	}
+	//签名通过以后才记录 nonce，避免伪造的请求占用 nonce
+	seen, err := cfg.nonceStore.Seen(nonce, 2*cfg.maxAge)
+	if err != nil {
+		//存储的错误信息只打日志，不返回给客户端
+		LOG.Errorf("auth_kratos_hash: operation=%s nonce store error=%v", tp.Operation(), err)
+		return errors.Unauthorized("UNAUTHORIZED", "auth_kratos_hash: nonce check failed")
+	}
+	if seen {
+		LOG.Warnf("auth_kratos_hash: operation=%s nonce=%s replay detected", tp.Operation(), nonce)
+		return errors.Unauthorized("REPLAY_DETECTED", "auth_kratos_hash: nonce is already used")
+	}
+	return nil
+}
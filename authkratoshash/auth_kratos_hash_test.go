@@ -0,0 +1,85 @@
+package authkratoshash
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+var secret = []byte("secret")
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+// newSignedTransport 模拟调用方按 Sign 计算签名并设置请求头
+func newSignedTransport(t *testing.T, tp *kratosmock.Transport, req interface{}, timestamp time.Time) *kratosmock.Transport {
+	body, err := BodyBytes(req)
+	require.NoError(t, err)
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return tp.WithHeader("X-Timestamp", ts).WithHeader("X-Signature", Sign(secret, GetMethod(tp), tp.Operation(), body, ts))
+}
+
+func callOnce(cfg *Config, tp *kratosmock.Transport, req interface{}) *errors.Error {
+	_, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(tp.NewContext(context.Background()), req)
+	return errors.FromError(err)
+}
+
+func TestNewMiddleware(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret)
+
+	for _, newTransport := range []func(string) *kratosmock.Transport{kratosmock.NewHTTPTransport, kratosmock.NewGRPCTransport} {
+		req := wrapperspb.String("hello")
+		tp := newSignedTransport(t, newTransport("/a"), req, time.Now())
+		require.Nil(t, callOnce(cfg, tp, req))
+
+		//篡改请求内容
+		erk := callOnce(cfg, tp, wrapperspb.String("hacked"))
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Contains(t, erk.Message, "signature is wrong")
+
+		//缺少签名
+		erk = callOnce(cfg, newTransport("/a"), req)
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Contains(t, erk.Message, "missing")
+	}
+
+	require.Nil(t, callOnce(cfg, kratosmock.NewHTTPTransport("/b"), nil))
+}
+
+func TestConfig_WithMaxAge(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret).WithMaxAge(time.Minute)
+
+	req := map[string]string{"name": "hello"}
+	require.Nil(t, callOnce(cfg, newSignedTransport(t, kratosmock.NewHTTPTransport("/a"), req, time.Now().Add(-30*time.Second)), req))
+
+	for _, timestamp := range []time.Time{time.Now().Add(-2 * time.Minute), time.Now().Add(2 * time.Minute)} {
+		erk := callOnce(cfg, newSignedTransport(t, kratosmock.NewHTTPTransport("/a"), req, timestamp), req)
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Contains(t, erk.Message, "expired")
+	}
+}
+
+func TestConfig_WithTimestampHeader(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret).WithTimestampHeader("X-Ts").WithSignatureHeader("X-Sign")
+
+	req := []byte("raw body")
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Ts", ts).WithHeader("X-Sign", Sign(secret, "POST", "/a", req, ts))
+	require.Nil(t, callOnce(cfg, tp, req))
+
+	tp = kratosmock.NewHTTPTransport("/a").WithHeader("X-Ts", ts).WithHeader("X-Sign", Sign([]byte("wrong"), "POST", "/a", req, ts))
+	require.True(t, errors.IsUnauthorized(callOnce(cfg, tp, req)))
+}
@@ -0,0 +1,93 @@
+package authkratoshash
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// NonceStore 记录用过的 nonce，Seen 返回 nonce 在 ttl 内是否出现过，没出现过时记录下来，需要是原子操作
+type NonceStore interface {
+	Seen(nonce string, ttl time.Duration) (bool, error)
+}
+
+// WithNonceHeader 设置 nonce 的请求头，设置以后 nonce 也参与签名，调用方用 SignWithNonce 计算签名
+// 需要同时用 WithNonceStore 设置记录 nonce 的存储
+func (a *Config) WithNonceHeader(name string) *Config {
+	a.nonceHeader = name
+	return a
+}
+
+// WithNonceStore 设置记录 nonce 的存储，签名校验通过以后记录 nonce，相同 nonce 的请求返回 REPLAY_DETECTED 错误
+// nonce 的保存时长是 WithMaxAge 的两倍，因为时间戳允许前后各偏差 maxAge
+func (a *Config) WithNonceStore(store NonceStore) *Config {
+	must.Full(store)
+	a.nonceStore = store
+	return a
+}
+
+// RedisNonceStore 使用 redis 记录 nonce，多个服务实例共享
+type RedisNonceStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+// NewRedisNonceStore 创建 redis 的 nonce 存储，key 是 prefix + nonce
+func NewRedisNonceStore(rdb redis.UniversalClient, prefix string) *RedisNonceStore {
+	must.Full(rdb)
+	return &RedisNonceStore{rdb: rdb, prefix: prefix}
+}
+
+func (s *RedisNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	ok, err := s.rdb.SetNX(context.Background(), s.prefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, erero.WithMessage(err, "auth_kratos_hash nonce redis exception")
+	}
+	return !ok, nil
+}
+
+// InMemoryNonceStore 使用进程内存记录 nonce，适合单测或者单实例部署
+type InMemoryNonceStore struct {
+	mutex   sync.Mutex
+	entries map[string]time.Time
+	inserts int //上次清理以后新记录的 nonce 数量
+}
+
+// nonceSweepSize 至少新记录这么多 nonce 以后才清理一次过期的 nonce
+const nonceSweepSize = 1024
+
+func NewInMemoryNonceStore() *InMemoryNonceStore {
+	return &InMemoryNonceStore{entries: map[string]time.Time{}}
+}
+
+func (s *InMemoryNonceStore) Seen(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if expiresAt, ok := s.entries[nonce]; ok && now.Before(expiresAt) {
+		return true, nil
+	}
+	s.entries[nonce] = now.Add(ttl)
+	s.inserts++
+	//新记录的数量超过阈值和当前数量时才清理，均摊下来每次记录的开销是常数，同时避免内存一直增长
+	if s.inserts >= nonceSweepSize && s.inserts >= len(s.entries)/2 {
+		s.sweep(now)
+	}
+	return false, nil
+}
+
+// sweep 删除过期的 nonce，调用方需要持有锁
+func (s *InMemoryNonceStore) sweep(now time.Time) {
+	for key, expiresAt := range s.entries {
+		if !now.Before(expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	s.inserts = 0
+}
@@ -0,0 +1,106 @@
+package authkratoshash
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newNonceTransport(nonce string, req []byte) *kratosmock.Transport {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return kratosmock.NewHTTPTransport("/a").
+		WithHeader("X-Timestamp", ts).
+		WithHeader("X-Nonce", nonce).
+		WithHeader("X-Signature", SignWithNonce(secret, "POST", "/a", req, ts, nonce))
+}
+
+func TestConfig_WithNonceStore(t *testing.T) {
+	mrd := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mrd.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	for _, store := range []NonceStore{NewInMemoryNonceStore(), NewRedisNonceStore(rdb, "nonce:")} {
+		cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret).WithNonceHeader("X-Nonce").WithNonceStore(store)
+		req := []byte("body")
+
+		tp := newNonceTransport("n1", req)
+		require.Nil(t, callOnce(cfg, tp, req))
+
+		//重放相同的请求
+		erk := callOnce(cfg, tp, req)
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Equal(t, "REPLAY_DETECTED", erk.Reason)
+
+		require.Nil(t, callOnce(cfg, newNonceTransport("n2", req), req))
+
+		//换了 nonce 但是没有重新签名
+		tp = newNonceTransport("n3", req).WithHeader("X-Nonce", "n4")
+		erk = callOnce(cfg, tp, req)
+		require.Contains(t, erk.Message, "signature is wrong")
+		//签名不对的请求不占用 nonce
+		require.Nil(t, callOnce(cfg, newNonceTransport("n4", req), req))
+
+		tp = newNonceTransport("n5", req).WithHeader("X-Nonce", "")
+		erk = callOnce(cfg, tp, req)
+		require.Contains(t, erk.Message, "nonce is missing")
+	}
+}
+
+func TestConfig_WithNonceStore_Error(t *testing.T) {
+	mrd := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mrd.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret).WithNonceHeader("X-Nonce").WithNonceStore(NewRedisNonceStore(rdb, "nonce:"))
+	req := []byte("body")
+	mrd.Close()
+
+	//存储的错误信息不返回给客户端
+	erk := callOnce(cfg, newNonceTransport("n1", req), req)
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Equal(t, "auth_kratos_hash: nonce check failed", erk.Message)
+}
+
+func TestInMemoryNonceStore(t *testing.T) {
+	store := NewInMemoryNonceStore()
+	seen, err := store.Seen("a", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, seen)
+	seen, _ = store.Seen("a", 50*time.Millisecond)
+	require.True(t, seen)
+
+	time.Sleep(60 * time.Millisecond)
+	seen, _ = store.Seen("a", 50*time.Millisecond)
+	require.False(t, seen)
+}
+
+func TestInMemoryNonceStore_Sweep(t *testing.T) {
+	store := NewInMemoryNonceStore()
+	for idx := 0; idx < nonceSweepSize; idx++ {
+		seen, err := store.Seen(strconv.Itoa(idx), time.Millisecond)
+		require.NoError(t, err)
+		require.False(t, seen)
+	}
+	require.Zero(t, store.inserts)
+
+	time.Sleep(2 * time.Millisecond)
+	for idx := 0; idx < nonceSweepSize; idx++ {
+		_, _ = store.Seen("x"+strconv.Itoa(idx), time.Minute)
+	}
+	require.Len(t, store.entries, nonceSweepSize)
+}
+
+func TestConfig_WithNonceHeader_NoStore(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret).WithNonceHeader("X-Nonce")
+	require.Panics(t, func() {
+		NewMiddleware(cfg, log.DefaultLogger)
+	})
+}
@@ -0,0 +1,201 @@
+package authkratosjwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+	"go.elastic.co/apm/v2"
+)
+
+// 支持的签名算法
+const (
+	SigningMethodHS256 = "HS256" //signingKey 是密钥原文
+	SigningMethodRS256 = "RS256" //signingKey 是 PEM 格式的 RSA 公钥
+	SigningMethodES256 = "ES256" //signingKey 是 PEM 格式的 ECDSA 公钥
+)
+
+type Config struct {
+	field             string
+	selectPath        authkratosroutes.Matcher
+	signingKey        []byte
+	signingMethod     string
+	apmSpanName       string
+	otelStart         func(ctx context.Context, spanName string) (context.Context, func())
+	debugMode         bool
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher, signingKey []byte, signingMethod string) *Config {
+	return &Config{
+		field:         "Authorization",
+		selectPath:    selectPath,
+		signingKey:    signingKey,
+		signingMethod: signingMethod,
+		apmSpanName:   "auth_kratos_jwt",
+		debugMode:     false,
+		enable:        true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable && a.field != ""
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印 JWT 校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+func (a *Config) GetField() string {
+	if a != nil {
+		return a.field
+	}
+	return ""
+}
+
+// WithSigningMethod 设置签名算法，支持 HS256 RS256 ES256
+func (a *Config) WithSigningMethod(signingMethod string) *Config {
+	a.signingMethod = signingMethod
+	return a
+}
+
+// WithFieldName 设置从哪个请求头里取 token，默认是 Authorization
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+func (a *Config) WithApmSpanName(apmSpanName string) *Config {
+	a.apmSpanName = apmSpanName
+	return a
+}
+
+func (a *Config) WithDebugMode(debugMode bool) *Config {
+	a.debugMode = debugMode
+	return a
+}
+
+// parseVerifyKey 把 signingKey 解析为验签使用的 key
+func (a *Config) parseVerifyKey() interface{} {
+	switch a.signingMethod {
+	case SigningMethodHS256:
+		must.Have(a.signingKey)
+		return a.signingKey
+	case SigningMethodRS256:
+		return must.V1(jwt.ParseRSAPublicKeyFromPEM(a.signingKey))
+	case SigningMethodES256:
+		return must.V1(jwt.ParseECPublicKeyFromPEM(a.signingKey))
+	default:
+		panic(a.signingMethod)
+	}
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_jwt middleware enable=%v field=%v method=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		cfg.signingMethod,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("auth_kratos_jwt", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if cfg.debugMode {
+			if match {
+				LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			} else {
+				LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			}
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	verifyKey := cfg.parseVerifyKey()
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{cfg.signingMethod}))
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		return verifyKey, nil
+	}
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_jwt: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				apmTx := apm.TransactionFromContext(ctx)
+				sp := apmTx.StartSpan(cfg.apmSpanName, "auth", nil)
+				defer sp.End()
+				if cfg.otelStart != nil {
+					var otelEnd func()
+					ctx, otelEnd = cfg.otelStart(ctx, cfg.apmSpanName)
+					defer otelEnd()
+				}
+
+				token := tp.RequestHeader().Get(cfg.field)
+				if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 && strings.EqualFold(messParts[0], "Bearer") {
+					token = messParts[1]
+				}
+				if token == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_jwt: auth token is missing")
+				}
+				claims := &jwt.RegisteredClaims{}
+				if _, err := parser.ParseWithClaims(token, claims, keyFunc); err != nil {
+					if errors.Is(err, jwt.ErrTokenExpired) {
+						return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_jwt: auth token is expired")
+					}
+					if cfg.debugMode {
+						LOG.Debugf("auth_kratos_jwt: parse token error:%v", err)
+					}
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_jwt: auth token is wrong")
+				}
+				if claims.Subject == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_jwt: auth token subject is missing")
+				}
+				if cfg.debugMode {
+					LOG.Debugf("auth_kratos_jwt: jwt token request username:%v pass", claims.Subject)
+				}
+				ctx = authkratostokens.SetUsernameIntoContext(ctx, claims.Subject)
+				return handleFunc(ctx, req)
+			}
+			return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_jwt: wrong context for middleware")
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package authkratosjwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return ctx, nil
+}
+
+func callWithToken(mw middleware.Middleware, token string) (context.Context, *errors.Error) {
+	tp := kratosmock.NewHTTPTransport("/a")
+	if token != "" {
+		tp.WithHeader("Authorization", token)
+	}
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		return nil, errors.FromError(err)
+	}
+	return res.(context.Context), nil
+}
+
+func newToken(t *testing.T, method jwt.SigningMethod, key interface{}, subject string, expiresAt time.Time) string {
+	claims := jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestNewMiddleware_HS256(t *testing.T) {
+	secret := []byte("secret")
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret, SigningMethodHS256).WithDebugMode(true)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	token := newToken(t, jwt.SigningMethodHS256, secret, "alice", time.Now().Add(time.Hour))
+	for _, value := range []string{token, "Bearer " + token, "bearer " + token} {
+		ctx, erk := callWithToken(mw, value)
+		require.Nil(t, erk)
+		username, ok := authkratostokens.GetUsername(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice", username)
+	}
+
+	_, erk := callWithToken(mw, "")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "missing")
+
+	_, erk = callWithToken(mw, newToken(t, jwt.SigningMethodHS256, secret, "alice", time.Now().Add(-time.Minute)))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "expired")
+
+	_, erk = callWithToken(mw, newToken(t, jwt.SigningMethodHS256, []byte("wrong"), "alice", time.Now().Add(time.Hour)))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "wrong")
+
+	_, erk = callWithToken(mw, newToken(t, jwt.SigningMethodHS256, secret, "", time.Now().Add(time.Hour)))
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestNewMiddleware_RS256(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), publicPem, SigningMethodHS256).WithSigningMethod(SigningMethodRS256)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx, erk := callWithToken(mw, newToken(t, jwt.SigningMethodRS256, privateKey, "bob", time.Now().Add(time.Hour)))
+	require.Nil(t, erk)
+	username, _ := authkratostokens.GetUsername(ctx)
+	require.Equal(t, "bob", username)
+
+	//算法不匹配时拒绝
+	_, erk = callWithToken(mw, newToken(t, jwt.SigningMethodHS256, publicPem, "bob", time.Now().Add(time.Hour)))
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestNewMiddleware_ES256(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), publicPem, SigningMethodES256).WithFieldName("X-Jwt").WithApmSpanName("jwt")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Jwt", newToken(t, jwt.SigningMethodES256, privateKey, "carl", time.Now().Add(time.Hour)))
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	require.NoError(t, err)
+	username, _ := authkratostokens.GetUsername(res.(context.Context))
+	require.Equal(t, "carl", username)
+}
+
+func TestNewMiddleware_UnknownMethod(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), []byte("secret"), "none")
+	require.Panics(t, func() {
+		NewMiddleware(cfg, log.DefaultLogger)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build otel
+
+package authkratosjwt
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithOtelTracer 使用 OTEL 记录认证的 span，span 名称和 WithApmSpanName 相同，可以和 apm span 同时使用
+// 需要使用 -tags otel 编译，避免不需要 OTEL 的项目引入依赖
+func (a *Config) WithOtelTracer(tracer trace.Tracer) *Config {
+	a.otelStart = func(ctx context.Context, spanName string) (context.Context, func()) {
+		ctx, span := tracer.Start(ctx, spanName)
+		return ctx, func() { span.End() }
+	}
+	return a
+}
@@ -0,0 +1,40 @@
+//go:build otel
+
+package authkratosjwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConfig_WithOtelTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	secret := []byte("secret")
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), secret, SigningMethodHS256).
+		WithApmSpanName("check_jwt").
+		WithOtelTracer(provider.Tracer("authkratos"))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	token := newToken(t, jwt.SigningMethodHS256, secret, "alice", time.Now().Add(time.Hour))
+	ctx, erk := callWithToken(mw, token)
+	require.Nil(t, erk)
+	require.True(t, trace.SpanContextFromContext(ctx).IsValid())
+
+	_, erk = callWithToken(mw, "wrong")
+	require.NotNil(t, erk)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		require.Equal(t, "check_jwt", span.Name())
+	}
+}
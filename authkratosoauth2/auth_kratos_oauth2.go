@@ -0,0 +1,240 @@
+package authkratosoauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+type Config struct {
+	field             string
+	selectPath        authkratosroutes.Matcher
+	introspectionURL  string
+	clientID          string
+	clientSecret      string
+	httpClient        *http.Client
+	cacheTTL          time.Duration
+	cacheSize         int
+	debugMode         bool
+	enable            bool
+	structuredLogging bool
+}
+
+// NewConfig 创建按 RFC 7662 调用授权服务的 introspection 接口校验 access token 的配置
+// clientID 和 clientSecret 是调用 introspection 接口使用的 Basic 认证
+func NewConfig(selectPath authkratosroutes.Matcher, introspectionURL string, clientID string, clientSecret string) *Config {
+	return &Config{
+		field:            "Authorization",
+		selectPath:       selectPath,
+		introspectionURL: introspectionURL,
+		clientID:         clientID,
+		clientSecret:     clientSecret,
+		cacheSize:        defaultCacheSize,
+		httpClient:       &http.Client{Timeout: 5 * time.Second},
+		debugMode:        false,
+		enable:           true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable && a.field != ""
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印 introspection 校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+func (a *Config) GetField() string {
+	if a != nil {
+		return a.field
+	}
+	return ""
+}
+
+// WithHTTPClient 设置调用 introspection 接口的客户端，比如设置超时时间，默认超时是 5 秒
+func (a *Config) WithHTTPClient(httpClient *http.Client) *Config {
+	must.Full(httpClient)
+	a.httpClient = httpClient
+	return a
+}
+
+// WithCacheTTL 缓存 active 的结果，ttl 时长内同一个 token 不再调用 introspection 接口
+// token 的 exp 早于缓存到期时间时以 exp 为准，inactive 的结果不缓存
+func (a *Config) WithCacheTTL(ttl time.Duration) *Config {
+	must.TRUE(ttl > 0)
+	a.cacheTTL = ttl
+	return a
+}
+
+// WithCacheSize 限制缓存的 token 数量，超过时淘汰最久没有使用的 token，默认是 10000
+func (a *Config) WithCacheSize(n int) *Config {
+	must.TRUE(n > 0)
+	a.cacheSize = n
+	return a
+}
+
+// WithFieldName 设置从哪个请求头里取 token，默认是 Authorization
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+func (a *Config) WithDebugMode(debugMode bool) *Config {
+	a.debugMode = debugMode
+	return a
+}
+
+// IntrospectionResponse 是 introspection 接口返回的字段，只解析需要的字段
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub"`
+	Username  string `json:"username"`
+	ClientID  string `json:"client_id"`
+	Scope     string `json:"scope"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// introspect 调用 introspection 接口，请求失败或者返回的状态码不是 200 时返回错误
+func (a *Config) introspect(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.introspectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(a.clientID, a.clientSecret)
+
+	response, err := a.httpClient.Do(request)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, erero.Errorf("introspection status=%d", response.StatusCode)
+	}
+	var res IntrospectionResponse
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &res, nil
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_oauth2 middleware enable=%v field=%v url=%v cache_ttl=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		cfg.introspectionURL,
+		cfg.cacheTTL,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("auth_kratos_oauth2", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if cfg.debugMode {
+			if match {
+				LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			} else {
+				LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			}
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	var cache *introspectionCache
+	if cfg.cacheTTL > 0 {
+		cache = newIntrospectionCache(cfg.cacheTTL, cfg.cacheSize)
+	}
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_oauth2: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				token := tp.RequestHeader().Get(cfg.field)
+				if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 && strings.EqualFold(messParts[0], "Bearer") {
+					token = messParts[1]
+				}
+				if token == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_oauth2: auth token is missing")
+				}
+				res, ok := cache.get(token)
+				if !ok {
+					var err error
+					res, err = cfg.introspect(ctx, token)
+					if err != nil {
+						LOG.Warnf("auth_kratos_oauth2: introspect token error:%v", err)
+						return nil, errors.ServiceUnavailable("INTROSPECTION_UNAVAILABLE", "auth_kratos_oauth2: introspection is unavailable")
+					}
+					if !res.Active {
+						return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_oauth2: auth token is inactive")
+					}
+					cache.put(token, res)
+				}
+				if res.ExpiresAt > 0 && time.Now().After(time.Unix(res.ExpiresAt, 0)) {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_oauth2: auth token is expired")
+				}
+				var username = res.Subject
+				if username == "" {
+					username = res.Username
+				}
+				if username == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_oauth2: auth token subject is missing")
+				}
+				if cfg.debugMode {
+					LOG.Debugf("auth_kratos_oauth2: oauth2 token request username:%v pass", username)
+				}
+				ctx = authkratostokens.SetUsernameIntoContext(ctx, username)
+				return handleFunc(ctx, req)
+			}
+			return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_oauth2: wrong context for middleware")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package authkratosoauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return ctx, nil
+}
+
+func callWithToken(mw middleware.Middleware, token string) (context.Context, *errors.Error) {
+	tp := kratosmock.NewHTTPTransport("/a")
+	if token != "" {
+		tp.WithHeader("Authorization", token)
+	}
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		return nil, errors.FromError(err)
+	}
+	return res.(context.Context), nil
+}
+
+// newIntrospectionServer 模拟 introspection 接口，tokens 是 token -> 返回结果，返回调用次数的计数
+func newIntrospectionServer(t *testing.T, tokens map[string]*IntrospectionResponse) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "client" || clientSecret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res, ok := tokens[r.PostFormValue("token")]
+		if !ok {
+			res = &IntrospectionResponse{Active: false}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(res))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestNewMiddleware(t *testing.T) {
+	server, _ := newIntrospectionServer(t, map[string]*IntrospectionResponse{
+		"alice-token":   {Active: true, Subject: "alice"},
+		"bob-token":     {Active: true, Username: "bob"},
+		"expired-token": {Active: true, Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		"nobody-token":  {Active: true},
+	})
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), server.URL, "client", "secret").WithDebugMode(true), log.DefaultLogger)
+
+	for _, value := range []string{"alice-token", "Bearer alice-token"} {
+		ctx, erk := callWithToken(mw, value)
+		require.Nil(t, erk)
+		username, ok := authkratostokens.GetUsername(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice", username)
+	}
+
+	ctx, erk := callWithToken(mw, "Bearer bob-token")
+	require.Nil(t, erk)
+	username, _ := authkratostokens.GetUsername(ctx)
+	require.Equal(t, "bob", username)
+
+	_, erk = callWithToken(mw, "")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "missing")
+
+	_, erk = callWithToken(mw, "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "inactive")
+
+	_, erk = callWithToken(mw, "expired-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "expired")
+
+	_, erk = callWithToken(mw, "nobody-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "subject")
+}
+
+func TestNewMiddleware_Unavailable(t *testing.T) {
+	server, _ := newIntrospectionServer(t, map[string]*IntrospectionResponse{})
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), server.URL, "client", "wrong"), log.DefaultLogger)
+	_, erk := callWithToken(mw, "alice-token")
+	require.True(t, errors.IsServiceUnavailable(erk))
+	require.Equal(t, "INTROSPECTION_UNAVAILABLE", erk.Reason)
+}
+
+func TestConfig_WithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(&IntrospectionResponse{Active: true, Subject: "alice"})
+	}))
+	defer server.Close()
+
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), server.URL, "client", "secret").WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond})
+	_, erk := callWithToken(NewMiddleware(cfg, log.DefaultLogger), "alice-token")
+	require.True(t, errors.IsServiceUnavailable(erk))
+}
+
+func TestConfig_WithCacheTTL(t *testing.T) {
+	server, calls := newIntrospectionServer(t, map[string]*IntrospectionResponse{
+		"alice-token": {Active: true, Subject: "alice"},
+	})
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), server.URL, "client", "secret").WithCacheTTL(time.Minute), log.DefaultLogger)
+
+	for idx := 0; idx < 3; idx++ {
+		ctx, erk := callWithToken(mw, "alice-token")
+		require.Nil(t, erk)
+		username, _ := authkratostokens.GetUsername(ctx)
+		require.Equal(t, "alice", username)
+	}
+	require.Equal(t, int64(1), calls.Load())
+
+	for idx := 0; idx < 2; idx++ {
+		_, erk := callWithToken(mw, "wrong-token")
+		require.True(t, errors.IsUnauthorized(erk))
+	}
+	require.Equal(t, int64(3), calls.Load())
+
+	calls.Store(0)
+	mw = NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), server.URL, "client", "secret"), log.DefaultLogger)
+	for idx := 0; idx < 2; idx++ {
+		_, erk := callWithToken(mw, "alice-token")
+		require.Nil(t, erk)
+	}
+	require.Equal(t, int64(2), calls.Load())
+}
@@ -0,0 +1,81 @@
+package authkratosoauth2
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize 没有设置 WithCacheSize 时缓存的 token 数量上限
+const defaultCacheSize = 10000
+
+type cachedIntrospection struct {
+	token     string
+	res       *IntrospectionResponse
+	expiresAt time.Time
+}
+
+// introspectionCache 缓存 active 的 introspection 结果，按 LRU 淘汰，nil 时表示不缓存
+type introspectionCache struct {
+	ttl     time.Duration
+	size    int
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newIntrospectionCache(ttl time.Duration, size int) *introspectionCache {
+	return &introspectionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *introspectionCache) get(token string) (*IntrospectionResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[token]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedIntrospection)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, token)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.res, true
+}
+
+func (c *introspectionCache) put(token string, res *IntrospectionResponse) {
+	if c == nil {
+		return
+	}
+	expiresAt := time.Now().Add(c.ttl)
+	if res.ExpiresAt > 0 && time.Unix(res.ExpiresAt, 0).Before(expiresAt) {
+		expiresAt = time.Unix(res.ExpiresAt, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &cachedIntrospection{token: token, res: res, expiresAt: expiresAt}
+	if element, ok := c.entries[token]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[token] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedIntrospection).token)
+	}
+}
@@ -0,0 +1,47 @@
+package authkratosoauth2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospectionCache(t *testing.T) {
+	cache := newIntrospectionCache(time.Minute, defaultCacheSize)
+	cache.put("a", &IntrospectionResponse{Active: true, Subject: "alice"})
+	res, ok := cache.get("a")
+	require.True(t, ok)
+	require.Equal(t, "alice", res.Subject)
+
+	_, ok = cache.get("b")
+	require.False(t, ok)
+
+	//exp 早于 ttl 时按 exp 过期
+	cache.put("c", &IntrospectionResponse{Active: true, Subject: "carol", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	_, ok = cache.get("c")
+	require.False(t, ok)
+
+	var nilCache *introspectionCache
+	nilCache.put("a", res)
+	_, ok = nilCache.get("a")
+	require.False(t, ok)
+}
+
+func TestIntrospectionCache_Size(t *testing.T) {
+	cache := newIntrospectionCache(time.Minute, 2)
+	cache.put("a", &IntrospectionResponse{Active: true, Subject: "alice"})
+	cache.put("b", &IntrospectionResponse{Active: true, Subject: "bob"})
+	_, ok := cache.get("a")
+	require.True(t, ok)
+
+	//超过数量时淘汰最久没有使用的 b
+	cache.put("c", &IntrospectionResponse{Active: true, Subject: "carol"})
+	_, ok = cache.get("b")
+	require.False(t, ok)
+	_, ok = cache.get("a")
+	require.True(t, ok)
+	_, ok = cache.get("c")
+	require.True(t, ok)
+	require.Equal(t, 2, cache.order.Len())
+}
@@ -0,0 +1,208 @@
+package authkratosopa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// Config 调用 OPA 的 REST API 判断接口权限，需要放在认证中间件的后面，从上下文里取认证通过的用户名
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	opaURL            string
+	policyPath        string
+	httpClient        *http.Client
+	timeout           time.Duration
+	cacheTTL          time.Duration
+	cacheSize         int
+	enable            bool
+	structuredLogging bool
+}
+
+// NewConfig 创建配置，请求的地址是 opaURL + "/v1/data/" + policyPath，比如 policyPath 是 "authz/allow"
+func NewConfig(selectPath authkratosroutes.Matcher, opaURL string, policyPath string) *Config {
+	return &Config{
+		selectPath: selectPath,
+		opaURL:     strings.TrimRight(opaURL, "/"),
+		policyPath: strings.Trim(policyPath, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    time.Second,
+		cacheSize:  defaultCacheSize,
+		enable:     true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印策略判断结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithHTTPClient 设置调用 OPA 的客户端，比如使用自定义的连接池
+func (a *Config) WithHTTPClient(httpClient *http.Client) *Config {
+	must.Full(httpClient)
+	a.httpClient = httpClient
+	return a
+}
+
+// WithTimeout 设置每次调用 OPA 的超时时间，默认是 1 秒
+func (a *Config) WithTimeout(timeout time.Duration) *Config {
+	must.TRUE(timeout > 0)
+	a.timeout = timeout
+	return a
+}
+
+// WithCacheTTL 缓存 OPA 的判断结果，ttl 时长内同一个用户调用同一个接口时不再请求 OPA，调用 OPA 出错时不缓存
+func (a *Config) WithCacheTTL(ttl time.Duration) *Config {
+	must.TRUE(ttl > 0)
+	a.cacheTTL = ttl
+	return a
+}
+
+// WithCacheSize 限制缓存的结果数量，超过时淘汰最久没有使用的结果，默认是 10000
+func (a *Config) WithCacheSize(n int) *Config {
+	must.TRUE(n > 0)
+	a.cacheSize = n
+	return a
+}
+
+// policyInput 是发给 OPA 的 input
+type policyInput struct {
+	Subject   string `json:"subject"`
+	Operation string `json:"operation"`
+}
+
+// evaluate 调用 OPA 的 Data API，result 是 true 时表示允许
+func (a *Config) evaluate(ctx context.Context, input *policyInput) (bool, error) {
+	data, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.opaURL+"/v1/data/"+a.policyPath, bytes.NewReader(data))
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := a.httpClient.Do(request)
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return false, erero.Errorf("opa status=%d", response.StatusCode)
+	}
+	var res struct {
+		Result interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		return false, erero.Wro(err)
+	}
+	allowed, ok := res.Result.(bool)
+	return ok && allowed, nil //策略不存在时 OPA 不返回 result，当作拒绝
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_opa middleware enable=%v url=%v policy=%v cache_ttl=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.opaURL,
+		cfg.policyPath,
+		cfg.cacheTTL,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("auth_kratos_opa", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must check policy", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip check policy", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	var cache *decisionCache
+	if cfg.cacheTTL > 0 {
+		cache = newDecisionCache(cfg.cacheTTL, cfg.cacheSize)
+	}
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_opa: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			tp, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_opa: wrong context for middleware")
+			}
+			username, ok := authkratostokens.GetUsername(ctx)
+			if !ok || username == "" {
+				return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_opa: username is missing")
+			}
+			input := &policyInput{Subject: username, Operation: tp.Operation()}
+			allowed, ok := cache.get(input)
+			if !ok {
+				var err error
+				allowed, err = cfg.evaluate(ctx, input)
+				if err != nil {
+					LOG.Warnf("auth_kratos_opa: subject:%v operation:%v evaluate error:%v", input.Subject, input.Operation, err)
+					return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_opa: evaluate policy failed")
+				}
+				cache.put(input, allowed)
+			}
+			if !allowed {
+				LOG.Infof("auth_kratos_opa: subject:%v operation:%v not pass", input.Subject, input.Operation)
+				return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_opa: operation not allowed")
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
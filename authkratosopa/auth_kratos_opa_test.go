@@ -0,0 +1,112 @@
+package authkratosopa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+// callWithUsername 模拟认证通过后的请求，username 为空时表示上下文里没有用户名
+func callWithUsername(mw middleware.Middleware, operation string, username string) error {
+	ctx := kratosmock.NewHTTPTransport(operation).NewContext(context.Background())
+	if username != "" {
+		ctx = authkratostokens.SetUsernameIntoContext(ctx, username)
+	}
+	_, err := mw(handleFunc)(ctx, nil)
+	return err
+}
+
+// newOPAServer 模拟 OPA 的 Data API，只允许 alice 调用 /a，返回调用次数的计数
+func newOPAServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/data/authz/allow" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Input policyInput `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		allowed := body.Input.Subject == "alice" && body.Input.Operation == "/a"
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": allowed})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestNewMiddleware(t *testing.T) {
+	server, _ := newOPAServer(t)
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a", "/b"), server.URL, "/authz/allow"), log.DefaultLogger)
+
+	require.NoError(t, callWithUsername(mw, "/a", "alice"))
+	require.True(t, errors.IsForbidden(callWithUsername(mw, "/a", "bob")))
+	require.True(t, errors.IsForbidden(callWithUsername(mw, "/b", "alice")))
+	require.True(t, errors.IsForbidden(callWithUsername(mw, "/a", "")))
+	require.NoError(t, callWithUsername(mw, "/c", ""))
+
+	//调用 OPA 出错时拒绝
+	mw = NewMiddleware(NewConfig(authkratosroutes.NewAll(), server.URL, "authz/missing"), log.DefaultLogger)
+	require.True(t, errors.IsForbidden(callWithUsername(mw, "/a", "alice")))
+}
+
+func TestNewMiddleware_UndefinedResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewAll(), server.URL, "authz/allow"), log.DefaultLogger)
+	require.True(t, errors.IsForbidden(callWithUsername(mw, "/a", "alice")))
+}
+
+func TestConfig_WithTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"result":true}`))
+	}))
+	defer server.Close()
+
+	cfg := NewConfig(authkratosroutes.NewAll(), server.URL, "authz/allow").WithTimeout(20 * time.Millisecond)
+	startTime := time.Now()
+	require.True(t, errors.IsForbidden(callWithUsername(NewMiddleware(cfg, log.DefaultLogger), "/a", "alice")))
+	require.Less(t, time.Since(startTime), 150*time.Millisecond)
+
+	cfg = NewConfig(authkratosroutes.NewAll(), server.URL, "authz/allow").WithHTTPClient(&http.Client{Timeout: 20 * time.Millisecond})
+	require.True(t, errors.IsForbidden(callWithUsername(NewMiddleware(cfg, log.DefaultLogger), "/a", "alice")))
+}
+
+func TestConfig_WithCacheTTL(t *testing.T) {
+	server, calls := newOPAServer(t)
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewAll(), server.URL, "authz/allow").WithCacheTTL(time.Minute), log.DefaultLogger)
+
+	for idx := 0; idx < 3; idx++ {
+		require.NoError(t, callWithUsername(mw, "/a", "alice"))
+		require.True(t, errors.IsForbidden(callWithUsername(mw, "/a", "bob")))
+	}
+	require.Equal(t, int64(2), calls.Load())
+}
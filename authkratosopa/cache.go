@@ -0,0 +1,76 @@
+package authkratosopa
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize 没有设置 WithCacheSize 时缓存的结果数量上限
+const defaultCacheSize = 10000
+
+type cachedDecision struct {
+	input     policyInput
+	allowed   bool
+	expiresAt time.Time
+}
+
+// decisionCache 按用户名和接口缓存 OPA 的判断结果，按 LRU 淘汰，nil 时表示不缓存
+type decisionCache struct {
+	ttl     time.Duration
+	size    int
+	mutex   sync.Mutex
+	entries map[policyInput]*list.Element
+	order   *list.List
+}
+
+func newDecisionCache(ttl time.Duration, size int) *decisionCache {
+	return &decisionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[policyInput]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *decisionCache) get(input *policyInput) (bool, bool) {
+	if c == nil {
+		return false, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[*input]
+	if !ok {
+		return false, false
+	}
+	entry := element.Value.(*cachedDecision)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, *input)
+		return false, false
+	}
+	c.order.MoveToFront(element)
+	return entry.allowed, true
+}
+
+func (c *decisionCache) put(input *policyInput, allowed bool) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &cachedDecision{input: *input, allowed: allowed, expiresAt: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[*input]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[*input] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedDecision).input)
+	}
+}
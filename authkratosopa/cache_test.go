@@ -0,0 +1,49 @@
+package authkratosopa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionCache(t *testing.T) {
+	cache := newDecisionCache(time.Minute, defaultCacheSize)
+	cache.put(&policyInput{Subject: "alice", Operation: "/a"}, true)
+	cache.put(&policyInput{Subject: "bob", Operation: "/a"}, false)
+
+	allowed, ok := cache.get(&policyInput{Subject: "alice", Operation: "/a"})
+	require.True(t, ok)
+	require.True(t, allowed)
+
+	allowed, ok = cache.get(&policyInput{Subject: "bob", Operation: "/a"})
+	require.True(t, ok)
+	require.False(t, allowed)
+
+	_, ok = cache.get(&policyInput{Subject: "alice", Operation: "/b"})
+	require.False(t, ok)
+
+	var nilCache *decisionCache
+	nilCache.put(&policyInput{Subject: "alice", Operation: "/a"}, true)
+	_, ok = nilCache.get(&policyInput{Subject: "alice", Operation: "/a"})
+	require.False(t, ok)
+}
+
+func TestDecisionCache_Size(t *testing.T) {
+	cache := newDecisionCache(time.Minute, 2)
+	cache.put(&policyInput{Subject: "alice", Operation: "/a"}, true)
+	cache.put(&policyInput{Subject: "bob", Operation: "/a"}, true)
+	_, ok := cache.get(&policyInput{Subject: "alice", Operation: "/a"})
+	require.True(t, ok)
+
+	//超过数量时淘汰最久没有使用的 bob
+	cache.put(&policyInput{Subject: "carol", Operation: "/a"}, false)
+	_, ok = cache.get(&policyInput{Subject: "bob", Operation: "/a"})
+	require.False(t, ok)
+	_, ok = cache.get(&policyInput{Subject: "alice", Operation: "/a"})
+	require.True(t, ok)
+	allowed, ok := cache.get(&policyInput{Subject: "carol", Operation: "/a"})
+	require.True(t, ok)
+	require.False(t, allowed)
+	require.Equal(t, 2, cache.order.Len())
+}
@@ -0,0 +1,202 @@
+package authkratospaseto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+)
+
+// 支持的 token 前缀
+const (
+	prefixV4Local  = "v4.local."  //对称加密，使用 localKey 解密
+	prefixV4Public = "v4.public." //非对称签名，使用 WithPublicKey 设置的公钥验签
+)
+
+type Config struct {
+	field             string
+	selectPath        authkratosroutes.Matcher
+	localKey          []byte
+	publicKey         ed25519.PublicKey
+	debugMode         bool
+	enable            bool
+	structuredLogging bool
+}
+
+// NewConfig 创建校验 v4.local token 的配置，localKey 是 32 字节的对称密钥
+// 只校验 v4.public token 时 localKey 可以传 nil，再用 WithPublicKey 设置公钥
+func NewConfig(selectPath authkratosroutes.Matcher, localKey []byte) *Config {
+	return &Config{
+		field:      "Authorization",
+		selectPath: selectPath,
+		localKey:   localKey,
+		debugMode:  false,
+		enable:     true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable && a.field != ""
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印 token 校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+func (a *Config) GetField() string {
+	if a != nil {
+		return a.field
+	}
+	return ""
+}
+
+// WithPublicKey 设置 ed25519 公钥，设置以后也支持 v4.public token
+func (a *Config) WithPublicKey(publicKey ed25519.PublicKey) *Config {
+	a.publicKey = publicKey
+	return a
+}
+
+// WithFieldName 设置从哪个请求头里取 token，默认是 Authorization
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+func (a *Config) WithDebugMode(debugMode bool) *Config {
+	a.debugMode = debugMode
+	return a
+}
+
+// verifier 是解析好的密钥，没有设置的密钥对应的 token 格式不支持
+type verifier struct {
+	localKey  *paseto.V4SymmetricKey
+	publicKey *paseto.V4AsymmetricPublicKey
+	parser    paseto.Parser
+}
+
+func newVerifier(cfg *Config) *verifier {
+	must.TRUE(len(cfg.localKey) > 0 || len(cfg.publicKey) > 0)
+
+	//过期时间单独判断，这样能区分过期和其它错误
+	res := &verifier{parser: paseto.NewParserWithoutExpiryCheck()}
+	if len(cfg.localKey) > 0 {
+		localKey := must.V1(paseto.V4SymmetricKeyFromBytes(cfg.localKey))
+		res.localKey = &localKey
+	}
+	if len(cfg.publicKey) > 0 {
+		publicKey := must.V1(paseto.NewV4AsymmetricPublicKeyFromEd25519(cfg.publicKey))
+		res.publicKey = &publicKey
+	}
+	return res
+}
+
+func (v *verifier) parse(token string) (*paseto.Token, error) {
+	switch {
+	case strings.HasPrefix(token, prefixV4Local) && v.localKey != nil:
+		return v.parser.ParseV4Local(*v.localKey, token, nil)
+	case strings.HasPrefix(token, prefixV4Public) && v.publicKey != nil:
+		return v.parser.ParseV4Public(*v.publicKey, token, nil)
+	default:
+		return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: unsupported token format")
+	}
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_paseto middleware enable=%v field=%v local=%v public=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		len(cfg.localKey) > 0,
+		len(cfg.publicKey) > 0,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("auth_kratos_paseto", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if cfg.debugMode {
+			if match {
+				LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			} else {
+				LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			}
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	verifier := newVerifier(cfg)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_paseto: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				token := tp.RequestHeader().Get(cfg.field)
+				if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 && strings.EqualFold(messParts[0], "Bearer") {
+					token = messParts[1]
+				}
+				if token == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: auth token is missing")
+				}
+				pasetoToken, err := verifier.parse(token)
+				if err != nil {
+					if cfg.debugMode {
+						LOG.Debugf("auth_kratos_paseto: parse token error:%v", err)
+					}
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: auth token is wrong")
+				}
+				if expiresAt, err := pasetoToken.GetExpiration(); err == nil && time.Now().After(expiresAt) {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: auth token is expired")
+				}
+				subject, err := pasetoToken.GetSubject()
+				if err != nil || subject == "" {
+					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: auth token subject is missing")
+				}
+				if cfg.debugMode {
+					LOG.Debugf("auth_kratos_paseto: paseto token request username:%v pass", subject)
+				}
+				ctx = authkratostokens.SetUsernameIntoContext(ctx, subject)
+				return handleFunc(ctx, req)
+			}
+			return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_paseto: wrong context for middleware")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package authkratospaseto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return ctx, nil
+}
+
+func callWithToken(mw middleware.Middleware, token string) (context.Context, *errors.Error) {
+	tp := kratosmock.NewHTTPTransport("/a")
+	if token != "" {
+		tp.WithHeader("Authorization", token)
+	}
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		return nil, errors.FromError(err)
+	}
+	return res.(context.Context), nil
+}
+
+func newToken(subject string, expiresAt time.Time) paseto.Token {
+	token := paseto.NewToken()
+	token.SetIssuedAt(time.Now())
+	token.SetExpiration(expiresAt)
+	if subject != "" {
+		token.SetSubject(subject)
+	}
+	return token
+}
+
+func TestNewMiddleware_V4Local(t *testing.T) {
+	localKey := paseto.NewV4SymmetricKey()
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), localKey.ExportBytes()).WithDebugMode(true)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	token := newToken("alice", time.Now().Add(time.Hour)).V4Encrypt(localKey, nil)
+	require.Contains(t, token, "v4.local.")
+	for _, value := range []string{token, "Bearer " + token} {
+		ctx, erk := callWithToken(mw, value)
+		require.Nil(t, erk)
+		username, ok := authkratostokens.GetUsername(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice", username)
+	}
+
+	_, erk := callWithToken(mw, "")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "missing")
+
+	_, erk = callWithToken(mw, newToken("alice", time.Now().Add(-time.Minute)).V4Encrypt(localKey, nil))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "expired")
+
+	_, erk = callWithToken(mw, newToken("alice", time.Now().Add(time.Hour)).V4Encrypt(paseto.NewV4SymmetricKey(), nil))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "wrong")
+
+	_, erk = callWithToken(mw, newToken("", time.Now().Add(time.Hour)).V4Encrypt(localKey, nil))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "subject")
+
+	//没有设置公钥时不支持 v4.public token
+	_, erk = callWithToken(mw, newToken("alice", time.Now().Add(time.Hour)).V4Sign(paseto.NewV4AsymmetricSecretKey(), nil))
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestConfig_WithPublicKey(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secretKey, err := paseto.NewV4AsymmetricSecretKeyFromEd25519(privateKey)
+	require.NoError(t, err)
+
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), nil).WithPublicKey(publicKey)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	token := newToken("bob", time.Now().Add(time.Hour)).V4Sign(secretKey, nil)
+	require.Contains(t, token, "v4.public.")
+	ctx, erk := callWithToken(mw, "Bearer "+token)
+	require.Nil(t, erk)
+	username, ok := authkratostokens.GetUsername(ctx)
+	require.True(t, ok)
+	require.Equal(t, "bob", username)
+
+	_, erk = callWithToken(mw, newToken("bob", time.Now().Add(time.Hour)).V4Sign(paseto.NewV4AsymmetricSecretKey(), nil))
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "wrong")
+
+	localKey := paseto.NewV4SymmetricKey()
+	mw = NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), localKey.ExportBytes()).WithPublicKey(publicKey), log.DefaultLogger)
+	for _, value := range []string{token, newToken("bob", time.Now().Add(time.Hour)).V4Encrypt(localKey, nil)} {
+		_, erk = callWithToken(mw, value)
+		require.Nil(t, erk)
+	}
+}
+
+func TestNewMiddleware_Skip(t *testing.T) {
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), paseto.NewV4SymmetricKey().ExportBytes()), log.DefaultLogger)
+	tp := kratosmock.NewHTTPTransport("/b")
+	_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,146 @@
+package authkratosrbac
+
+import (
+	"context"
+	"slices"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosctx"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+)
+
+// Config 按角色校验接口权限，需要放在认证中间件的后面，从上下文的 authkratosctx.UserInfo 里取角色
+// 使用 NewCasbinConfig 创建时改为按 casbin 策略校验
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	requiredRoles     []string
+	requireAll        bool
+	enforcer          Enforcer
+	roleLoader        func(ctx context.Context) (string, error)
+	enable            bool
+	structuredLogging bool
+}
+
+// NewConfig 创建按角色校验的配置，requiredRoles 不能为空，否则 WithAllRoles 时全部用户都能通过而默认时全部用户都不能通过
+func NewConfig(selectPath authkratosroutes.Matcher, requiredRoles []string) *Config {
+	must.Have(requiredRoles)
+	return &Config{
+		selectPath:    selectPath,
+		requiredRoles: requiredRoles,
+		requireAll:    false,
+		enable:        true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印权限校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithAnyRole 用户有 requiredRoles 里的任意一个角色就能通过，这是默认的逻辑
+func (a *Config) WithAnyRole() *Config {
+	a.requireAll = false
+	return a
+}
+
+// WithAllRoles 用户需要有 requiredRoles 里的全部角色才能通过
+func (a *Config) WithAllRoles() *Config {
+	a.requireAll = true
+	return a
+}
+
+func (a *Config) checkRoles(roles []string) bool {
+	if a.requireAll {
+		for _, role := range a.requiredRoles {
+			if !slices.Contains(roles, role) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, role := range a.requiredRoles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new auth_kratos_rbac middleware enable=%v roles=%v require_all=%v casbin=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.requiredRoles,
+		cfg.requireAll,
+		cfg.enforcer != nil,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("auth_kratos_rbac", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must check roles", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip check roles", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("auth_kratos_rbac: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if cfg.enforcer != nil {
+				if erk := checkCasbin(ctx, cfg, LOG); erk != nil {
+					return nil, erk
+				}
+				return handleFunc(ctx, req)
+			}
+			userInfo, ok := authkratosctx.GetUserInfo(ctx)
+			if !ok {
+				return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: user info is missing")
+			}
+			if !cfg.checkRoles(userInfo.Roles) {
+				LOG.Infof("auth_kratos_rbac: username:%v roles:%v not pass", userInfo.Username, userInfo.Roles)
+				return nil, errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: user roles not allowed")
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package authkratosrbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosctx"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+// callWithRoles 模拟认证通过后的请求，roles 为 nil 时表示上下文里没有用户信息
+func callWithRoles(mw middleware.Middleware, tp *kratosmock.Transport, roles []string) error {
+	ctx := tp.NewContext(context.Background())
+	if roles != nil {
+		ctx = authkratosctx.SetUserInfoIntoContext(ctx, authkratosctx.UserInfo{Username: "alice", Roles: roles})
+	}
+	_, err := mw(handleFunc)(ctx, nil)
+	return err
+}
+
+func TestNewMiddleware(t *testing.T) {
+	mw := NewMiddleware(NewConfig(authkratosroutes.NewInclude("/a"), []string{"admin", "dev"}), log.DefaultLogger)
+
+	for _, tp := range []*kratosmock.Transport{kratosmock.NewHTTPTransport("/a"), kratosmock.NewGRPCTransport("/a")} {
+		require.NoError(t, callWithRoles(mw, tp, []string{"dev"}))
+		require.NoError(t, callWithRoles(mw, tp, []string{"guest", "admin"}))
+		require.True(t, errors.IsForbidden(callWithRoles(mw, tp, []string{"guest"})))
+		require.True(t, errors.IsForbidden(callWithRoles(mw, tp, []string{})))
+		require.True(t, errors.IsForbidden(callWithRoles(mw, tp, nil)))
+	}
+	require.NoError(t, callWithRoles(mw, kratosmock.NewHTTPTransport("/b"), nil))
+}
+
+func TestConfig_WithAllRoles(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), []string{"admin", "dev"}).WithAllRoles()
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	tp := kratosmock.NewHTTPTransport("/a")
+	require.NoError(t, callWithRoles(mw, tp, []string{"dev", "admin", "guest"}))
+	require.True(t, errors.IsForbidden(callWithRoles(mw, tp, []string{"dev"})))
+
+	mw = NewMiddleware(cfg.WithAnyRole(), log.DefaultLogger)
+	require.NoError(t, callWithRoles(mw, tp, []string{"dev"}))
+}
+
+func TestConfig_SetEnable(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), []string{"admin"})
+	cfg.SetEnable(false)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.NoError(t, callWithRoles(mw, kratosmock.NewHTTPTransport("/a"), nil))
+}
+
+func TestNewConfig_EmptyRoles(t *testing.T) {
+	require.Panics(t, func() {
+		NewConfig(authkratosroutes.NewInclude("/a"), nil)
+	})
+	require.Panics(t, func() {
+		NewConfig(authkratosroutes.NewInclude("/a"), []string{})
+	})
+}
@@ -0,0 +1,71 @@
+package authkratosrbac
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/yyle88/must"
+)
+
+// CasbinAction 是调用 Enforce 时使用的 action，策略里写成 p, alice, /pkg.Service/Method, execute
+const CasbinAction = "execute"
+
+// Enforcer 是 casbin 的策略判断接口，*casbin.Enforcer *casbin.SyncedEnforcer *casbin.CachedEnforcer 都实现了这个接口
+type Enforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}
+
+// NewCasbinConfig 按 casbin 策略校验接口权限，调用 enforcer.Enforce(username, operation, "execute")
+// 需要放在认证中间件的后面，默认从上下文里取认证通过的用户名
+func NewCasbinConfig(selectPath authkratosroutes.Matcher, enforcer Enforcer) *Config {
+	must.Full(enforcer)
+	return &Config{
+		selectPath: selectPath,
+		enforcer:   enforcer,
+		enable:     true,
+	}
+}
+
+// WithRoleLoader 自定义 Enforce 使用的 subject，比如使用角色而不是用户名，返回错误时请求返回 403
+func (a *Config) WithRoleLoader(roleLoader func(ctx context.Context) (string, error)) *Config {
+	a.roleLoader = roleLoader
+	return a
+}
+
+func (a *Config) loadSubject(ctx context.Context) (string, error) {
+	if a.roleLoader != nil {
+		return a.roleLoader(ctx)
+	}
+	username, ok := authkratostokens.GetUsername(ctx)
+	if !ok || username == "" {
+		return "", errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: username is missing")
+	}
+	return username, nil
+}
+
+// checkCasbin 调用 casbin 判断 subject 能否执行当前的 operation
+func checkCasbin(ctx context.Context, cfg *Config, LOG *log.Helper) *errors.Error {
+	tp, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: wrong context for middleware")
+	}
+	subject, err := cfg.loadSubject(ctx)
+	if err != nil {
+		LOG.Infof("auth_kratos_rbac: operation:%v load subject error:%v not pass", tp.Operation(), err)
+		return errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: subject is missing")
+	}
+	allowed, err := cfg.enforcer.Enforce(subject, tp.Operation(), CasbinAction)
+	if err != nil {
+		LOG.Warnf("auth_kratos_rbac: subject:%v operation:%v enforce error:%v", subject, tp.Operation(), err)
+		return errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: enforce policy failed")
+	}
+	if !allowed {
+		LOG.Infof("auth_kratos_rbac: subject:%v operation:%v not pass", subject, tp.Operation())
+		return errors.Forbidden("FORBIDDEN", "auth_kratos_rbac: operation not allowed")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package authkratosrbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/authkratostokens"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+const testCasbinModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+func newTestEnforcer(t *testing.T) *casbin.Enforcer {
+	m, err := model.NewModelFromString(testCasbinModel)
+	require.NoError(t, err)
+	enforcer, err := casbin.NewEnforcer(m)
+	require.NoError(t, err)
+	_, err = enforcer.AddPolicy("alice", "/a", CasbinAction)
+	require.NoError(t, err)
+	_, err = enforcer.AddPolicy("admin", "/b", CasbinAction)
+	require.NoError(t, err)
+	_, err = enforcer.AddGroupingPolicy("bob", "admin")
+	require.NoError(t, err)
+	return enforcer
+}
+
+// callWithUsername 模拟认证通过后的请求，username 为空时表示上下文里没有用户名
+func callWithUsername(mw middleware.Middleware, tp *kratosmock.Transport, username string) error {
+	ctx := tp.NewContext(context.Background())
+	if username != "" {
+		ctx = authkratostokens.SetUsernameIntoContext(ctx, username)
+	}
+	_, err := mw(handleFunc)(ctx, nil)
+	return err
+}
+
+func TestNewCasbinConfig(t *testing.T) {
+	mw := NewMiddleware(NewCasbinConfig(authkratosroutes.NewExclude("/c"), newTestEnforcer(t)), log.DefaultLogger)
+
+	for _, newTransport := range []func(string) *kratosmock.Transport{kratosmock.NewHTTPTransport, kratosmock.NewGRPCTransport} {
+		require.NoError(t, callWithUsername(mw, newTransport("/a"), "alice"))
+		require.NoError(t, callWithUsername(mw, newTransport("/b"), "bob"))
+		require.True(t, errors.IsForbidden(callWithUsername(mw, newTransport("/b"), "alice")))
+		require.True(t, errors.IsForbidden(callWithUsername(mw, newTransport("/a"), "bob")))
+		require.True(t, errors.IsForbidden(callWithUsername(mw, newTransport("/a"), "")))
+		require.NoError(t, callWithUsername(mw, newTransport("/c"), ""))
+	}
+}
+
+func TestConfig_WithRoleLoader(t *testing.T) {
+	cfg := NewCasbinConfig(authkratosroutes.NewAll(), newTestEnforcer(t)).WithRoleLoader(func(ctx context.Context) (string, error) {
+		username, _ := authkratostokens.GetUsername(ctx)
+		if username == "carol" {
+			return "admin", nil
+		}
+		return "", errors.Forbidden("FORBIDDEN", "no role")
+	})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	require.NoError(t, callWithUsername(mw, kratosmock.NewHTTPTransport("/b"), "carol"))
+	require.True(t, errors.IsForbidden(callWithUsername(mw, kratosmock.NewHTTPTransport("/a"), "carol")))
+	require.True(t, errors.IsForbidden(callWithUsername(mw, kratosmock.NewHTTPTransport("/b"), "alice")))
+}
@@ -0,0 +1,65 @@
+package authkratosroutes
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/yyle88/erero"
+)
+
+// CoverageEnforcer 单测工具，不是线上中间件，在单测里断言可以用 testutils.AssertCoverage
+// 在单测里收集服务实际提供的 operation，再检查这些 operation 被 selectPath 覆盖的比例
+// 这样当服务新增接口却忘记配置到认证范围里时，CI 就会失败
+type CoverageEnforcer struct {
+	requiredCoverage float64
+	mutex            sync.Mutex
+	operations       map[Path]bool
+}
+
+func NewCoverageEnforcer(requiredCoverage float64) *CoverageEnforcer {
+	return &CoverageEnforcer{
+		requiredCoverage: requiredCoverage,
+		operations:       map[Path]bool{},
+	}
+}
+
+// Observe 记录一个 operation，可以并发调用
+func (c *CoverageEnforcer) Observe(operation string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.operations[New(operation)] = true
+}
+
+// Uncovered 返回没有被 selectPath 命中的 operation 列表，按字典序排列
+func (c *CoverageEnforcer) Uncovered(selectPath *SelectPath) []Path {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var paths []Path
+	for path := range c.operations {
+		if !selectPath.Match(string(path)) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
+
+// Coverage 返回已记录的 operation 里被 selectPath 命中的比例，没有记录时返回1
+func (c *CoverageEnforcer) Coverage(selectPath *SelectPath) float64 {
+	uncovered := len(c.Uncovered(selectPath))
+	c.mutex.Lock()
+	total := len(c.operations)
+	c.mutex.Unlock()
+	if total == 0 {
+		return 1
+	}
+	return float64(total-uncovered) / float64(total)
+}
+
+// CheckCoverage 当覆盖比例低于 requiredCoverage 时返回错误，错误信息里包含没有覆盖的 operation
+func (c *CoverageEnforcer) CheckCoverage(selectPath *SelectPath) error {
+	if coverage := c.Coverage(selectPath); coverage < c.requiredCoverage {
+		return erero.Errorf("operations coverage=%v less than required=%v uncovered=%v", coverage, c.requiredCoverage, c.Uncovered(selectPath))
+	}
+	return nil
+}
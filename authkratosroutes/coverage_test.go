@@ -0,0 +1,36 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverageEnforcer(t *testing.T) {
+	enforcer := NewCoverageEnforcer(1.0)
+	enforcer.Observe("/a")
+	enforcer.Observe("/b")
+	enforcer.Observe("/c")
+	enforcer.Observe("/c")
+
+	full := NewInclude("/a", "/b", "/c")
+	require.Equal(t, 1.0, enforcer.Coverage(full))
+	require.NoError(t, enforcer.CheckCoverage(full))
+
+	part := NewInclude("/a", "/b")
+	require.InDelta(t, 2.0/3.0, enforcer.Coverage(part), 0.0001)
+	require.Equal(t, []Path{"/c"}, enforcer.Uncovered(part))
+	require.Error(t, enforcer.CheckCoverage(part))
+
+	require.Equal(t, 1.0, NewCoverageEnforcer(1.0).Coverage(part))
+}
+
+func TestCoverageEnforcer_Required(t *testing.T) {
+	enforcer := NewCoverageEnforcer(0.6)
+	enforcer.Observe("/a")
+	enforcer.Observe("/b")
+	enforcer.Observe("/c")
+
+	require.NoError(t, enforcer.CheckCoverage(NewExclude("/c")))
+	require.Error(t, enforcer.CheckCoverage(NewExclude("/b", "/c")))
+}
@@ -0,0 +1,50 @@
+package authkratosroutes
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+)
+
+// NewMatchFuncWithDeadline 给匹配过程设置时间限制，超时时返回 false 即跳过中间件
+// 当 matcher 里需要调用外部服务才能判断时使用，避免匹配卡住整个请求
+func NewMatchFuncWithDeadline(matcher Matcher, timeout time.Duration, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	type matchResult struct {
+		match bool
+		cause interface{}
+	}
+
+	return func(ctx context.Context, operation string) bool {
+		//通道带缓冲，超时返回以后协程依然能写入结果并退出，不会泄漏
+		results := make(chan *matchResult, 1)
+		go func() {
+			defer func() {
+				if cause := recover(); cause != nil {
+					results <- &matchResult{cause: cause}
+				}
+			}()
+			results <- &matchResult{match: matcher.Match(operation)}
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case result := <-results:
+			if result.cause != nil {
+				panic(result.cause) //在调用方的协程里抛出，和同步调用 Match 时的行为相同
+			}
+			return result.match
+		case <-timer.C:
+			LOG.Warnf("operation=%s match timeout=%v so skip", operation, timeout)
+			return false
+		case <-ctx.Done():
+			LOG.Warnf("operation=%s match context done so skip", operation)
+			return false
+		}
+	}
+}
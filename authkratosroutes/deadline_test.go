@@ -0,0 +1,42 @@
+package authkratosroutes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/require"
+)
+
+type sleepMatcher struct {
+	delay time.Duration
+}
+
+func (m *sleepMatcher) Match(operation string) bool {
+	time.Sleep(m.delay)
+	return true
+}
+
+func TestNewMatchFuncWithDeadline(t *testing.T) {
+	matchFunc := NewMatchFuncWithDeadline(&sleepMatcher{delay: time.Millisecond}, 100*time.Millisecond, log.DefaultLogger)
+	require.True(t, matchFunc(context.Background(), "/a"))
+
+	matchFunc = NewMatchFuncWithDeadline(&sleepMatcher{delay: 200 * time.Millisecond}, 20*time.Millisecond, log.DefaultLogger)
+	startTime := time.Now()
+	require.False(t, matchFunc(context.Background(), "/a"))
+	require.Less(t, time.Since(startTime), 150*time.Millisecond)
+}
+
+func TestNewMatchFuncWithDeadline_SelectPath(t *testing.T) {
+	matchFunc := NewMatchFuncWithDeadline(NewInclude("/a"), time.Second, log.DefaultLogger)
+	require.True(t, matchFunc(context.Background(), "/a"))
+	require.False(t, matchFunc(context.Background(), "/b"))
+}
+
+func TestNewMatchFuncWithDeadline_Panic(t *testing.T) {
+	matchFunc := NewMatchFuncWithDeadline(&SelectPath{SelectSide: "UNKNOWN"}, time.Second, log.DefaultLogger)
+	require.Panics(t, func() {
+		matchFunc(context.Background(), "/a")
+	})
+}
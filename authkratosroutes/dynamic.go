@@ -0,0 +1,43 @@
+package authkratosroutes
+
+import (
+	"sync/atomic"
+
+	"github.com/yyle88/must"
+)
+
+// DynamicSelectPath 可以在运行时整体替换的选择，中间件持有 DynamicSelectPath 时不需要重建中间件就能改变选择的接口
+// 和 SelectPath.SetOperations 相比可以同时替换 side、通配符和正则
+type DynamicSelectPath struct {
+	current atomic.Pointer[SelectPath]
+}
+
+func NewDynamic(initial *SelectPath) *DynamicSelectPath {
+	must.Nice(initial)
+	res := &DynamicSelectPath{}
+	res.current.Store(initial)
+	return res
+}
+
+// Update 替换当前的选择，后续的请求立即使用新的选择，和 Match 并发调用是安全的
+func (d *DynamicSelectPath) Update(selectPath *SelectPath) {
+	must.Nice(selectPath)
+	d.current.Store(selectPath)
+}
+
+// Load 返回当前的选择
+func (d *DynamicSelectPath) Load() *SelectPath {
+	return d.current.Load()
+}
+
+func (d *DynamicSelectPath) Match(operation string) bool {
+	return d.current.Load().Match(operation)
+}
+
+func (d *DynamicSelectPath) GetSide() SelectSide {
+	return d.current.Load().GetSide()
+}
+
+func (d *DynamicSelectPath) Len() int {
+	return d.current.Load().Len()
+}
@@ -0,0 +1,58 @@
+package authkratosroutes
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicSelectPath_Update(t *testing.T) {
+	dynamic := NewDynamic(NewInclude("/a"))
+	require.True(t, dynamic.Match("/a"))
+	require.False(t, dynamic.Match("/b"))
+	require.Equal(t, INCLUDE, SideOf(dynamic))
+	require.Equal(t, 1, LenOf(dynamic))
+
+	dynamic.Update(NewExclude("/a"))
+	require.False(t, dynamic.Match("/a"))
+	require.True(t, dynamic.Match("/b"))
+	require.Equal(t, EXCLUDE, dynamic.Load().SelectSide)
+
+	require.Panics(t, func() {
+		dynamic.Update(nil)
+	})
+}
+
+func TestDynamicSelectPath_Race(t *testing.T) {
+	dynamic := NewDynamic(NewInclude("/a"))
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := 0; num < 1000; num++ {
+				dynamic.Match("/a")
+			}
+		}()
+	}
+	for num := 0; num < 100; num++ {
+		dynamic.Update(NewInclude("/a", "/b"))
+	}
+	wg.Wait()
+	require.True(t, dynamic.Match("/b"))
+}
+
+type customMatcher struct{}
+
+func (customMatcher) Match(operation string) bool {
+	return operation == "/a"
+}
+
+func TestSideOf(t *testing.T) {
+	require.Equal(t, INCLUDE, SideOf(NewInclude("/a")))
+	require.Equal(t, 2, LenOf(NewExclude("/a", "/b")))
+	require.Equal(t, SelectSide(""), SideOf(customMatcher{}))
+	require.Equal(t, -1, LenOf(customMatcher{}))
+}
@@ -0,0 +1,44 @@
+package authkratosroutes
+
+import (
+	"os"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// NewIncludeFromEnv 从环境变量读取逗号分隔的 operation 列表，比如 k8s 的 ConfigMap 注入的环境变量
+// 环境变量没有设置时不匹配任何 operation，即 NewNone
+func NewIncludeFromEnv(envKey string, LOGGER log.Logger) *SelectPath {
+	paths, ok := lookupEnvPaths(envKey, LOGGER)
+	if !ok {
+		return NewNone()
+	}
+	return NewInclude(paths...)
+}
+
+// NewExcludeFromEnv 从环境变量读取逗号分隔的要排除的 operation 列表
+// 环境变量没有设置时不排除任何 operation，即 NewAll
+func NewExcludeFromEnv(envKey string, LOGGER log.Logger) *SelectPath {
+	paths, ok := lookupEnvPaths(envKey, LOGGER)
+	if !ok {
+		return NewAll()
+	}
+	return NewExclude(paths...)
+}
+
+// lookupEnvPaths 按逗号拆分环境变量，去掉空白和空的项
+func lookupEnvPaths(envKey string, LOGGER log.Logger) ([]Path, bool) {
+	value, ok := os.LookupEnv(envKey)
+	if !ok {
+		log.NewHelper(LOGGER).Warnf("env=%s not set so no operations", envKey)
+		return nil, false
+	}
+	var paths []Path
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			paths = append(paths, New(item))
+		}
+	}
+	return paths, true
+}
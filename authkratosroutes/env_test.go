@@ -0,0 +1,29 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIncludeFromEnv(t *testing.T) {
+	t.Setenv("AUTH_KRATOS_ROUTES_TEST", " /a , /b,,")
+	selectPath := NewIncludeFromEnv("AUTH_KRATOS_ROUTES_TEST", log.DefaultLogger)
+	require.Equal(t, INCLUDE, selectPath.GetSide())
+	require.Equal(t, []Path{"/a", "/b"}, selectPath.GetOperations())
+	require.True(t, selectPath.Match("/a"))
+	require.False(t, selectPath.Match("/c"))
+
+	require.True(t, NewIncludeFromEnv("AUTH_KRATOS_ROUTES_MISSING", log.DefaultLogger).IsNone())
+}
+
+func TestNewExcludeFromEnv(t *testing.T) {
+	t.Setenv("AUTH_KRATOS_ROUTES_TEST", "/a,/b")
+	selectPath := NewExcludeFromEnv("AUTH_KRATOS_ROUTES_TEST", log.DefaultLogger)
+	require.Equal(t, EXCLUDE, selectPath.GetSide())
+	require.False(t, selectPath.Match("/a"))
+	require.True(t, selectPath.Match("/c"))
+
+	require.True(t, NewExcludeFromEnv("AUTH_KRATOS_ROUTES_MISSING", log.DefaultLogger).IsAll())
+}
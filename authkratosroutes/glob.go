@@ -0,0 +1,47 @@
+package authkratosroutes
+
+import "path"
+
+// NewIncludeGlob 按通配符选择 operation，规则和 path.Match 相同，比如 "/pkg.Service/*" 选择服务的全部方法
+func NewIncludeGlob(patterns ...string) *SelectPath {
+	return &SelectPath{
+		SelectSide: INCLUDE,
+		Operations: map[Path]bool{},
+		globs:      mustGlobs(patterns),
+	}
+}
+
+// NewExcludeGlob 按通配符排除 operation，规则和 path.Match 相同
+func NewExcludeGlob(patterns ...string) *SelectPath {
+	return &SelectPath{
+		SelectSide: EXCLUDE,
+		Operations: map[Path]bool{},
+		globs:      mustGlobs(patterns),
+	}
+}
+
+// mustGlobs 在创建时检查通配符的格式，避免请求时才发现格式错误
+func mustGlobs(patterns []string) []string {
+	if err := checkGlobs(patterns); err != nil {
+		panic(err)
+	}
+	return patterns
+}
+
+func checkGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchGlobs(patterns []string, operation string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, operation); ok {
+			return true
+		}
+	}
+	return false
+}
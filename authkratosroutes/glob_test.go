@@ -0,0 +1,32 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIncludeGlob(t *testing.T) {
+	include := NewIncludeGlob("/pkg.SomeStub/*", "/pkg.Other/Get*")
+	require.True(t, include.Match("/pkg.SomeStub/Create"))
+	require.True(t, include.Match("/pkg.SomeStub/Update"))
+	require.True(t, include.Match("/pkg.Other/GetUser"))
+	require.False(t, include.Match("/pkg.Other/SetUser"))
+	require.False(t, include.Match("/pkg.SomeStubX/Create"))
+	require.False(t, include.Match("/pkg.SomeStub/a/b"))
+
+	require.False(t, include.Opposite().Match("/pkg.SomeStub/Create"))
+	require.True(t, include.Opposite().Match("/pkg.Other/SetUser"))
+}
+
+func TestNewExcludeGlob(t *testing.T) {
+	exclude := NewExcludeGlob("/pkg.Health/*")
+	require.False(t, exclude.Match("/pkg.Health/Check"))
+	require.True(t, exclude.Match("/pkg.SomeStub/Create"))
+}
+
+func TestNewIncludeGlob_BadPattern(t *testing.T) {
+	require.Panics(t, func() {
+		NewIncludeGlob("/pkg.SomeStub/[")
+	})
+}
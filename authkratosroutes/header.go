@@ -0,0 +1,27 @@
+package authkratosroutes
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// NewMatchFuncFromHeader 根据请求头的值选择是否执行中间件，而不是根据 operation 路径选择
+// 比如灰度时设置 X-Feature-Flag: new-auth 的请求才走新的中间件
+// 用法 selector.Server(mw).Match(NewMatchFuncFromHeader("X-Feature-Flag", "new-auth", LOGGER)).Build()
+func NewMatchFuncFromHeader(headerName string, expectedValue string, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		tp, ok := transport.FromServerContext(ctx)
+		if !ok {
+			return false
+		}
+		value := tp.RequestHeader().Get(headerName)
+		match := value == expectedValue
+		LOG.Debugf("operation=%s header=%s value=%s expected=%s match=%v", operation, headerName, value, expectedValue, match)
+		return match
+	}
+}
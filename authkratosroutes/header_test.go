@@ -0,0 +1,33 @@
+package authkratosroutes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMatchFuncFromHeader(t *testing.T) {
+	matchFunc := NewMatchFuncFromHeader("X-Feature-Flag", "new-auth", log.DefaultLogger)
+
+	t.Run("expected-value", func(t *testing.T) {
+		ctx := kratosmock.NewHTTPTransport("/a").WithHeader("X-Feature-Flag", "new-auth").NewContext(context.Background())
+		require.True(t, matchFunc(ctx, "/a"))
+	})
+
+	t.Run("different-value", func(t *testing.T) {
+		ctx := kratosmock.NewHTTPTransport("/a").WithHeader("X-Feature-Flag", "old-auth").NewContext(context.Background())
+		require.False(t, matchFunc(ctx, "/a"))
+	})
+
+	t.Run("header-absent", func(t *testing.T) {
+		ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+		require.False(t, matchFunc(ctx, "/a"))
+	})
+
+	t.Run("no-transport", func(t *testing.T) {
+		require.False(t, matchFunc(context.Background(), "/a"))
+	})
+}
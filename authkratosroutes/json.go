@@ -0,0 +1,67 @@
+package authkratosroutes
+
+import (
+	"encoding/json"
+
+	"github.com/yyle88/erero"
+)
+
+// selectPathJSON 是 SelectPath 的 json 格式，比如 {"side":"INCLUDE","operations":["/a","/b"]}
+type selectPathJSON struct {
+	Side       SelectSide `json:"side"`
+	Operations []Path     `json:"operations"`
+	Globs      []string   `json:"globs,omitempty"`
+	Regexps    []string   `json:"regexps,omitempty"`
+}
+
+// NewFromJSON 从 json 创建选择，side 只能是 INCLUDE 或 EXCLUDE
+func NewFromJSON(data []byte) (*SelectPath, error) {
+	var res = &SelectPath{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return res, nil
+}
+
+// MarshalJSON 输出排序后的 operation 列表，这样相同的选择总是得到相同的 json
+func (c *SelectPath) MarshalJSON() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	operations := c.sortedOperations()
+	var regexps = make([]string, 0, len(c.regexps))
+	for _, re := range c.regexps {
+		regexps = append(regexps, re.String())
+	}
+	return json.Marshal(&selectPathJSON{
+		Side:       c.SelectSide,
+		Operations: operations,
+		Globs:      c.globs,
+		Regexps:    regexps,
+	})
+}
+
+func (c *SelectPath) UnmarshalJSON(data []byte) error {
+	var value selectPathJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return erero.Wro(err)
+	}
+	if value.Side != INCLUDE && value.Side != EXCLUDE {
+		return erero.Errorf("side must be %s or %s but got %q", INCLUDE, EXCLUDE, value.Side)
+	}
+	if err := checkGlobs(value.Globs); err != nil {
+		return erero.Wro(err)
+	}
+	regexps, err := compileRegexps(value.Regexps)
+	if err != nil {
+		return erero.Wro(err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.SelectSide = value.Side
+	c.Operations = NewPathsBooMap(value.Operations)
+	c.globs = value.Globs
+	c.regexps = regexps
+	return nil
+}
@@ -0,0 +1,55 @@
+package authkratosroutes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPath_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(NewInclude("/b", "/a"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"side":"INCLUDE","operations":["/a","/b"]}`, string(data))
+
+	selectPath, err := NewFromJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, INCLUDE, selectPath.SelectSide)
+	require.Equal(t, NewPathsBooMap([]Path{"/a", "/b"}), selectPath.Operations)
+
+	again, err := json.Marshal(selectPath)
+	require.NoError(t, err)
+	require.Equal(t, string(data), string(again))
+}
+
+func TestNewFromJSON(t *testing.T) {
+	selectPath, err := NewFromJSON([]byte(`{"side":"EXCLUDE","operations":["/a"],"globs":["/pkg.Health/*"],"regexps":["^/debug\\."]}`))
+	require.NoError(t, err)
+	require.False(t, selectPath.Match("/a"))
+	require.False(t, selectPath.Match("/pkg.Health/Check"))
+	require.False(t, selectPath.Match("/debug.Service/Dump"))
+	require.True(t, selectPath.Match("/b"))
+
+	data, err := json.Marshal(selectPath)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"side":"EXCLUDE","operations":["/a"],"globs":["/pkg.Health/*"],"regexps":["^/debug\\."]}`, string(data))
+
+	for _, text := range []string{
+		`{"side":"UNKNOWN","operations":["/a"]}`,
+		`{"side":"INCLUDE","globs":["["]}`,
+		`{"side":"INCLUDE","regexps":["("]}`,
+		`not json`,
+	} {
+		_, err := NewFromJSON([]byte(text))
+		require.Error(t, err, text)
+	}
+}
+
+func TestSelectPath_UnmarshalJSON(t *testing.T) {
+	var value struct {
+		RouteScope *SelectPath `json:"route_scope"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"route_scope":{"side":"INCLUDE","operations":["/a"]}}`), &value))
+	require.True(t, value.RouteScope.Match("/a"))
+	require.False(t, value.RouteScope.Match("/b"))
+}
@@ -0,0 +1,50 @@
+package authkratosroutes
+
+import "regexp"
+
+// NewIncludeRegex 按正则选择 operation，比如 `^/v[12]\.SomeStub/` 同时选择两个版本的服务，正则格式错误时 panic
+func NewIncludeRegex(patterns ...string) *SelectPath {
+	return &SelectPath{
+		SelectSide: INCLUDE,
+		Operations: map[Path]bool{},
+		regexps:    mustRegexps(patterns),
+	}
+}
+
+// NewExcludeRegex 按正则排除 operation，正则格式错误时 panic
+func NewExcludeRegex(patterns ...string) *SelectPath {
+	return &SelectPath{
+		SelectSide: EXCLUDE,
+		Operations: map[Path]bool{},
+		regexps:    mustRegexps(patterns),
+	}
+}
+
+func mustRegexps(patterns []string) []*regexp.Regexp {
+	var regexps = make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regexps = append(regexps, regexp.MustCompile(pattern))
+	}
+	return regexps
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	var regexps = make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
+func matchRegexps(regexps []*regexp.Regexp, operation string) bool {
+	for _, re := range regexps {
+		if re.MatchString(operation) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIncludeRegex(t *testing.T) {
+	include := NewIncludeRegex(`^/v[12]\.SomeStub/`)
+	require.True(t, include.Match("/v1.SomeStub/Create"))
+	require.True(t, include.Match("/v2.SomeStub/Update"))
+	require.False(t, include.Match("/v3.SomeStub/Create"))
+	require.False(t, include.Match("/v1xSomeStub/Create"))
+
+	require.False(t, include.Opposite().Match("/v1.SomeStub/Create"))
+}
+
+func TestNewExcludeRegex(t *testing.T) {
+	exclude := NewExcludeRegex(`/Health$`, `^/debug\.`)
+	require.False(t, exclude.Match("/pkg.Service/Health"))
+	require.False(t, exclude.Match("/debug.Service/Dump"))
+	require.True(t, exclude.Match("/pkg.Service/Create"))
+}
+
+func TestNewIncludeRegex_BadPattern(t *testing.T) {
+	require.Panics(t, func() {
+		NewIncludeRegex(`^/v[12`)
+	})
+}
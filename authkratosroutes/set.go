@@ -0,0 +1,122 @@
+package authkratosroutes
+
+// 把 INCLUDE 看作选择集合里的 operation，把 EXCLUDE 看作选择集合以外的全部 operation，按集合运算得到新的选择：
+//
+//	Union:        INCLUDE(A) ∪ INCLUDE(B) = INCLUDE(A ∪ B)
+//	              EXCLUDE(A) ∪ EXCLUDE(B) = EXCLUDE(A ∩ B)
+//	              INCLUDE(A) ∪ EXCLUDE(B) = EXCLUDE(B - A)
+//	Intersection: INCLUDE(A) ∩ INCLUDE(B) = INCLUDE(A ∩ B)
+//	              EXCLUDE(A) ∩ EXCLUDE(B) = EXCLUDE(A ∪ B)
+//	              INCLUDE(A) ∩ EXCLUDE(B) = INCLUDE(A - B)
+//	Difference:   INCLUDE(A) - INCLUDE(B) = INCLUDE(A - B)
+//	              INCLUDE(A) - EXCLUDE(B) = INCLUDE(A ∩ B)
+//	              EXCLUDE(A) - INCLUDE(B) = EXCLUDE(A ∪ B)
+//	              EXCLUDE(A) - EXCLUDE(B) = INCLUDE(B - A)
+//
+// 因此结果对任意 operation 的 Match 结果和分别 Match 再取或/取与/取差相同
+// 通配符和正则无法做精确的集合运算，因此只支持精确的 operation 集合，带通配符或正则时 panic
+
+// Union 返回两个选择的并集，任意一个选择匹配的 operation 都匹配
+func (c *SelectPath) Union(other *SelectPath) *SelectPath {
+	sideA, setA := c.snapshot()
+	sideB, setB := other.snapshot()
+	switch {
+	case sideA == INCLUDE && sideB == INCLUDE:
+		return newSelectPath(INCLUDE, unionSet(setA, setB))
+	case sideA == EXCLUDE && sideB == EXCLUDE:
+		return newSelectPath(EXCLUDE, intersectSet(setA, setB))
+	case sideA == INCLUDE && sideB == EXCLUDE:
+		return newSelectPath(EXCLUDE, differenceSet(setB, setA))
+	default: //EXCLUDE 和 INCLUDE
+		return newSelectPath(EXCLUDE, differenceSet(setA, setB))
+	}
+}
+
+// Intersection 返回两个选择的交集，两个选择都匹配的 operation 才匹配
+func (c *SelectPath) Intersection(other *SelectPath) *SelectPath {
+	sideA, setA := c.snapshot()
+	sideB, setB := other.snapshot()
+	switch {
+	case sideA == INCLUDE && sideB == INCLUDE:
+		return newSelectPath(INCLUDE, intersectSet(setA, setB))
+	case sideA == EXCLUDE && sideB == EXCLUDE:
+		return newSelectPath(EXCLUDE, unionSet(setA, setB))
+	case sideA == INCLUDE && sideB == EXCLUDE:
+		return newSelectPath(INCLUDE, differenceSet(setA, setB))
+	default: //EXCLUDE 和 INCLUDE
+		return newSelectPath(INCLUDE, differenceSet(setB, setA))
+	}
+}
+
+// Difference 返回两个选择的差集，当前选择匹配并且 other 不匹配的 operation 才匹配
+// 比如全局认证的选择去掉某个服务自己接管的 operation
+func (c *SelectPath) Difference(other *SelectPath) *SelectPath {
+	sideA, setA := c.snapshot()
+	sideB, setB := other.snapshot()
+	switch {
+	case sideA == INCLUDE && sideB == INCLUDE:
+		return newSelectPath(INCLUDE, differenceSet(setA, setB))
+	case sideA == EXCLUDE && sideB == EXCLUDE:
+		return newSelectPath(INCLUDE, differenceSet(setB, setA))
+	case sideA == INCLUDE && sideB == EXCLUDE:
+		return newSelectPath(INCLUDE, intersectSet(setA, setB))
+	default: //EXCLUDE 和 INCLUDE
+		return newSelectPath(EXCLUDE, unionSet(setA, setB))
+	}
+}
+
+// snapshot 复制当前的选择，side 未知或者带通配符和正则时 panic
+func (c *SelectPath) snapshot() (SelectSide, map[Path]bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if c.SelectSide != INCLUDE && c.SelectSide != EXCLUDE {
+		panic(c.SelectSide)
+	}
+	if len(c.globs) > 0 || len(c.regexps) > 0 {
+		panic("set operation does not support glob or regex patterns")
+	}
+	return c.SelectSide, c.clone(c.SelectSide).Operations
+}
+
+func newSelectPath(side SelectSide, operations map[Path]bool) *SelectPath {
+	return &SelectPath{
+		SelectSide: side,
+		Operations: operations,
+	}
+}
+
+func unionSet(a, b map[Path]bool) map[Path]bool {
+	var res = make(map[Path]bool, len(a)+len(b))
+	for path, ok := range a {
+		if ok {
+			res[path] = true
+		}
+	}
+	for path, ok := range b {
+		if ok {
+			res[path] = true
+		}
+	}
+	return res
+}
+
+func intersectSet(a, b map[Path]bool) map[Path]bool {
+	var res = map[Path]bool{}
+	for path, ok := range a {
+		if ok && b[path] {
+			res[path] = true
+		}
+	}
+	return res
+}
+
+func differenceSet(a, b map[Path]bool) map[Path]bool {
+	var res = map[Path]bool{}
+	for path, ok := range a {
+		if ok && !b[path] {
+			res[path] = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPath_Union(t *testing.T) {
+	checkSetOperation(t, func(a, b *SelectPath) *SelectPath { return a.Union(b) }, func(x, y bool) bool { return x || y })
+
+	require.Equal(t, INCLUDE, NewInclude("/a").Union(NewInclude("/b")).SelectSide)
+	require.Equal(t, EXCLUDE, NewInclude("/a").Union(NewExclude("/b")).SelectSide)
+}
+
+func TestSelectPath_Intersection(t *testing.T) {
+	checkSetOperation(t, func(a, b *SelectPath) *SelectPath { return a.Intersection(b) }, func(x, y bool) bool { return x && y })
+
+	require.Equal(t, INCLUDE, NewInclude("/a").Intersection(NewExclude("/b")).SelectSide)
+	require.Equal(t, EXCLUDE, NewExclude("/a").Intersection(NewExclude("/b")).SelectSide)
+}
+
+func TestSelectPath_Difference(t *testing.T) {
+	checkSetOperation(t, func(a, b *SelectPath) *SelectPath { return a.Difference(b) }, func(x, y bool) bool { return x && !y })
+
+	require.Equal(t, INCLUDE, NewInclude("/a").Difference(NewInclude("/b")).SelectSide)
+	require.Equal(t, INCLUDE, NewInclude("/a").Difference(NewExclude("/b")).SelectSide)
+	require.Equal(t, EXCLUDE, NewExclude("/a").Difference(NewInclude("/b")).SelectSide)
+	require.Equal(t, INCLUDE, NewExclude("/a").Difference(NewExclude("/b")).SelectSide)
+	require.Equal(t, []Path{"/a"}, NewInclude("/a", "/b").Difference(NewInclude("/b", "/c")).GetOperations())
+}
+
+// checkSetOperation 对 INCLUDE/EXCLUDE 的各种组合检查，结果的 Match 等于分别 Match 以后再按 expect 合并
+func checkSetOperation(t *testing.T, operate func(a, b *SelectPath) *SelectPath, expect func(x, y bool) bool) {
+	newSelectPaths := []func(paths ...Path) *SelectPath{NewInclude, NewExclude}
+	operations := []string{"/a", "/b", "/c", "/d"}
+	for _, newA := range newSelectPaths {
+		for _, newB := range newSelectPaths {
+			a := newA("/a", "/b")
+			b := newB("/b", "/c")
+			res := operate(a, b)
+			for _, operation := range operations {
+				require.Equal(t, expect(a.Match(operation), b.Match(operation)), res.Match(operation), operation)
+			}
+		}
+	}
+}
+
+func TestSelectPath_Union_Panic(t *testing.T) {
+	require.Panics(t, func() {
+		(&SelectPath{SelectSide: "UNKNOWN"}).Union(NewInclude("/a"))
+	})
+	require.Panics(t, func() {
+		NewInclude("/a").Intersection(&SelectPath{SelectSide: "UNKNOWN"})
+	})
+	require.Panics(t, func() {
+		NewIncludeGlob("/a/*").Union(NewInclude("/a"))
+	})
+}
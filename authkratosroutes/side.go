@@ -1,5 +1,11 @@
 package authkratosroutes
 
+import (
+	"regexp"
+	"slices"
+	"sync"
+)
+
 type SelectSide string
 
 const (
@@ -7,9 +13,39 @@ const (
 	EXCLUDE SelectSide = "EXCLUDE"
 )
 
+// Matcher 判断 operation 是否需要执行中间件，SelectPath 实现了这个接口
+type Matcher interface {
+	Match(operation string) bool
+}
+
+// scopeDescriber 能描述选择范围的 Matcher，SelectPath 和 DynamicSelectPath 都实现了这个接口
+type scopeDescriber interface {
+	GetSide() SelectSide
+	Len() int
+}
+
+// SideOf 返回 Matcher 的 side，用于中间件打印日志，自定义的 Matcher 返回空字符串
+func SideOf(matcher Matcher) SelectSide {
+	if describer, ok := matcher.(scopeDescriber); ok {
+		return describer.GetSide()
+	}
+	return ""
+}
+
+// LenOf 返回 Matcher 的 operation 数量，用于中间件打印日志，自定义的 Matcher 返回 -1
+func LenOf(matcher Matcher) int {
+	if describer, ok := matcher.(scopeDescriber); ok {
+		return describer.Len()
+	}
+	return -1
+}
+
 type SelectPath struct {
 	SelectSide SelectSide
 	Operations map[Path]bool
+	globs      []string
+	regexps    []*regexp.Regexp
+	mutex      sync.RWMutex
 }
 
 func NewInclude(paths ...Path) *SelectPath {
@@ -26,19 +62,222 @@ func NewExclude(paths ...Path) *SelectPath {
 	}
 }
 
+// NewAll 匹配全部 operation，等价于 EXCLUDE 空集合
+func NewAll() *SelectPath {
+	return &SelectPath{
+		SelectSide: EXCLUDE,
+		Operations: map[Path]bool{},
+	}
+}
+
+// NewNone 不匹配任何 operation，等价于 INCLUDE 空集合
+func NewNone() *SelectPath {
+	return &SelectPath{
+		SelectSide: INCLUDE,
+		Operations: map[Path]bool{},
+	}
+}
+
+// IsAll 判断是否匹配全部 operation，即 EXCLUDE 并且没有任何 operation、通配符和正则
+func (c *SelectPath) IsAll() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.SelectSide == EXCLUDE && c.isBlank()
+}
+
+// IsNone 判断是否不匹配任何 operation，即 INCLUDE 并且没有任何 operation、通配符和正则
+func (c *SelectPath) IsNone() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.SelectSide == INCLUDE && c.isBlank()
+}
+
+func (c *SelectPath) isBlank() bool {
+	if len(c.globs) > 0 || len(c.regexps) > 0 {
+		return false
+	}
+	for _, ok := range c.Operations {
+		if ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Opposite 返回相反的选择，operation 集合相同但 INCLUDE 和 EXCLUDE 互换，因此对任意 operation 的结果都相反
+func (c *SelectPath) Opposite() *SelectPath {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var side SelectSide
+	switch c.SelectSide {
+	case INCLUDE:
+		side = EXCLUDE
+	case EXCLUDE:
+		side = INCLUDE
+	default:
+		panic(c.SelectSide)
+	}
+	return c.clone(side)
+}
+
+// Add 返回增加了这些 operation 的新选择，原来的选择不变
+func (c *SelectPath) Add(paths ...Path) *SelectPath {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	res := c.clone(c.SelectSide)
+	for _, path := range paths {
+		res.Operations[path] = true
+	}
+	return res
+}
+
+// Remove 返回去掉了这些 operation 的新选择，原来的选择不变，只影响精确的 operation 集合，不影响通配符和正则
+func (c *SelectPath) Remove(paths ...Path) *SelectPath {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	res := c.clone(c.SelectSide)
+	for _, path := range paths {
+		delete(res.Operations, path)
+	}
+	return res
+}
+
+// Clone 返回深拷贝，operation 集合是新的 map，修改拷贝的 Operations 或者调用 SetOperations 都不影响原来的选择
+// 比如每个租户在公共选择的基础上增加自己的 operation
+func (c *SelectPath) Clone() *SelectPath {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.clone(c.SelectSide)
+}
+
+// Equal 判断两个选择是否相同，即 side 相同并且 operation 集合、通配符和正则都相同，和 map 的遍历顺序无关
+func (c *SelectPath) Equal(other *SelectPath) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	if c == other {
+		return true
+	}
+	if c.GetSide() != other.GetSide() {
+		return false
+	}
+	if !slices.Equal(c.GetOperations(), other.GetOperations()) {
+		return false
+	}
+	globsA, regexpsA := c.patterns()
+	globsB, regexpsB := other.patterns()
+	return slices.Equal(globsA, globsB) && slices.Equal(regexpsA, regexpsB)
+}
+
+// patterns 返回通配符和正则的字符串形式
+func (c *SelectPath) patterns() ([]string, []string) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var regexps = make([]string, 0, len(c.regexps))
+	for _, re := range c.regexps {
+		regexps = append(regexps, re.String())
+	}
+	return c.globs, regexps
+}
+
+// clone 复制 operation 集合，调用方需要持有读锁
+func (c *SelectPath) clone(side SelectSide) *SelectPath {
+	operations := make(map[Path]bool, len(c.Operations))
+	for path, ok := range c.Operations {
+		operations[path] = ok
+	}
+	return &SelectPath{
+		SelectSide: side,
+		Operations: operations,
+		globs:      c.globs,
+		regexps:    c.regexps,
+	}
+}
+
+// SetOperations 整体替换 operation 集合，比如从配置中心重新加载时使用，和 Match 并发调用是安全的
+func (c *SelectPath) SetOperations(paths []Path) {
+	operations := NewPathsBooMap(paths)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Operations = operations
+}
+
 func (c *SelectPath) Match(operation string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
 	switch c.SelectSide {
 	case INCLUDE:
-		if c.Operations == nil {
-			return false
-		}
-		return c.Operations[Path(operation)]
+		return c.contains(operation)
 	case EXCLUDE:
-		if c.Operations == nil {
-			return true
-		}
-		return !c.Operations[Path(operation)]
+		return !c.contains(operation)
 	default:
 		panic(c.SelectSide)
 	}
 }
+
+// contains 先查精确的 operation 集合，没有时再依次匹配通配符和正则
+func (c *SelectPath) contains(operation string) bool {
+	if c.Operations[Path(operation)] {
+		return true
+	}
+	if matchGlobs(c.globs, operation) {
+		return true
+	}
+	return matchRegexps(c.regexps, operation)
+}
+
+// GetSide 返回当前的 side，和 SetOperations 并发调用是安全的
+func (c *SelectPath) GetSide() SelectSide {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.SelectSide
+}
+
+// Len 返回精确的 operation 集合的数量，不包括通配符和正则
+func (c *SelectPath) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var count = 0
+	for _, ok := range c.Operations {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// IsEmpty 判断精确的 operation 集合是否为空
+func (c *SelectPath) IsEmpty() bool {
+	return c.Len() == 0
+}
+
+// GetOperations 返回排序后的 operation 列表，因为字段 Operations 已经占用了这个名字所以加 Get 前缀
+func (c *SelectPath) GetOperations() []Path {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.sortedOperations()
+}
+
+// sortedOperations 调用方需要持有读锁
+func (c *SelectPath) sortedOperations() []Path {
+	var operations = make([]Path, 0, len(c.Operations))
+	for path, ok := range c.Operations {
+		if ok {
+			operations = append(operations, path)
+		}
+	}
+	slices.Sort(operations)
+	return operations
+}
@@ -1 +1,200 @@
 package authkratosroutes
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPath_Match(t *testing.T) {
+	include := NewInclude("/a", "/b")
+	require.True(t, include.Match("/a"))
+	require.False(t, include.Match("/c"))
+
+	exclude := NewExclude("/a", "/b")
+	require.False(t, exclude.Match("/a"))
+	require.True(t, exclude.Match("/c"))
+
+	require.Panics(t, func() {
+		(&SelectPath{SelectSide: "UNKNOWN"}).Match("/a")
+	})
+}
+
+func TestSelectPath_SetOperations(t *testing.T) {
+	selectPath := NewInclude("/a")
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 10; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := 0; num < 1000; num++ {
+				selectPath.Match("/a")
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for num := 0; num < 100; num++ {
+			selectPath.SetOperations([]Path{"/b", "/c"})
+		}
+	}()
+	wg.Wait()
+
+	require.False(t, selectPath.Match("/a"))
+	require.True(t, selectPath.Match("/b"))
+	require.True(t, selectPath.Match("/c"))
+}
+
+func TestSelectPath_Opposite(t *testing.T) {
+	include := NewInclude("/a")
+	exclude := include.Opposite()
+	require.Equal(t, EXCLUDE, exclude.SelectSide)
+	require.False(t, exclude.Match("/a"))
+	require.True(t, exclude.Match("/b"))
+	require.Equal(t, INCLUDE, exclude.Opposite().SelectSide)
+}
+
+func FuzzSelectPath_Match(f *testing.F) {
+	f.Add("", true, "")
+	f.Add("/a,/b", true, "/a")
+	f.Add("/a,/b", false, "/c")
+	f.Add(",", false, "")
+	f.Add("/pkg.Service/Method,/pkg.Service/*", true, "/pkg.Service/Method")
+	f.Add("/中文/接口,\x00\n\t", false, "\x00")
+	f.Add(strings.Repeat("/long", 1000), true, strings.Repeat("/long", 1000))
+
+	f.Fuzz(func(t *testing.T, operations string, include bool, operation string) {
+		var paths []Path
+		for _, item := range strings.Split(operations, ",") {
+			paths = append(paths, New(item))
+		}
+		var selectPath *SelectPath
+		if include {
+			selectPath = NewInclude(paths...)
+		} else {
+			selectPath = NewExclude(paths...)
+		}
+		require.Equal(t, !selectPath.Match(operation), selectPath.Opposite().Match(operation))
+	})
+}
+
+func TestSelectPath_Add(t *testing.T) {
+	include := NewInclude("/a")
+	derived := include.Add("/b", "/c")
+	require.True(t, derived.Match("/a"))
+	require.True(t, derived.Match("/b"))
+	require.True(t, derived.Match("/c"))
+	require.False(t, include.Match("/b"))
+
+	exclude := NewExclude("/a")
+	derived = exclude.Add("/b")
+	require.False(t, derived.Match("/b"))
+	require.True(t, exclude.Match("/b"))
+}
+
+func TestSelectPath_Remove(t *testing.T) {
+	include := NewInclude("/a", "/b")
+	derived := include.Remove("/b", "/x")
+	require.True(t, derived.Match("/a"))
+	require.False(t, derived.Match("/b"))
+	require.True(t, include.Match("/b"))
+
+	exclude := NewExclude("/a", "/b")
+	derived = exclude.Remove("/a")
+	require.True(t, derived.Match("/a"))
+	require.False(t, exclude.Match("/a"))
+}
+
+func TestSelectPath_Clone(t *testing.T) {
+	source := NewInclude("/a", "/b")
+	cloned := source.Clone()
+	require.Equal(t, INCLUDE, cloned.GetSide())
+	require.Equal(t, []Path{"/a", "/b"}, cloned.GetOperations())
+
+	cloned.Operations["/c"] = true
+	require.True(t, cloned.Match("/c"))
+	require.False(t, source.Match("/c"))
+
+	source.SetOperations([]Path{"/x"})
+	require.True(t, cloned.Match("/a"))
+	require.False(t, cloned.Match("/x"))
+	require.False(t, source.Match("/a"))
+
+	require.True(t, NewAll().Clone().IsAll())
+	require.True(t, NewNone().Clone().IsNone())
+
+	none := NewNone().Clone()
+	none.Operations["/a"] = true
+	require.True(t, none.Match("/a"))
+	require.False(t, none.IsNone())
+	require.True(t, NewIncludeGlob("/api/*").Clone().Match("/api/v1"))
+}
+
+func TestSelectPath_Equal(t *testing.T) {
+	require.True(t, NewInclude("/a", "/b").Equal(NewInclude("/b", "/a")))
+	require.True(t, NewExclude("/a", "/b").Equal(NewExclude("/b", "/a")))
+	require.True(t, NewExclude().Equal(NewAll()))
+
+	require.False(t, NewInclude("/a").Equal(NewExclude("/a")))
+	require.False(t, NewInclude("/a").Equal(NewInclude("/a", "/b")))
+	require.False(t, NewExclude("/a").Equal(NewExclude("/b")))
+
+	require.True(t, NewIncludeGlob("/api/*").Equal(NewIncludeGlob("/api/*")))
+	require.False(t, NewIncludeGlob("/api/*").Equal(NewIncludeGlob("/v1/*")))
+	require.True(t, NewIncludeRegex("^/a$").Equal(NewIncludeRegex("^/a$")))
+	require.False(t, NewIncludeRegex("^/a$").Equal(NewInclude()))
+
+	var nilPath *SelectPath
+	require.True(t, nilPath.Equal(nil))
+	require.False(t, nilPath.Equal(NewAll()))
+}
+
+func TestSelectPath_Len(t *testing.T) {
+	selectPath := NewInclude("/b", "/a")
+	require.Equal(t, 2, selectPath.Len())
+	require.False(t, selectPath.IsEmpty())
+	require.Equal(t, []Path{"/a", "/b"}, selectPath.GetOperations())
+
+	selectPath = NewExclude()
+	require.Equal(t, 0, selectPath.Len())
+	require.True(t, selectPath.IsEmpty())
+	require.Empty(t, selectPath.GetOperations())
+
+	require.True(t, (&SelectPath{SelectSide: INCLUDE, Operations: map[Path]bool{"/a": false}}).IsEmpty())
+}
+
+func TestNewAll(t *testing.T) {
+	all := NewAll()
+	require.True(t, all.Match("/a"))
+	require.True(t, all.Match(""))
+	require.True(t, all.IsAll())
+	require.False(t, all.IsNone())
+	require.True(t, NewExclude().IsAll())
+	require.False(t, NewExclude("/a").IsAll())
+	require.False(t, NewExcludeGlob("/a/*").IsAll())
+
+	require.True(t, all.Opposite().IsNone())
+	require.False(t, all.Add("/a").Match("/a"))
+
+	all.Operations["/b"] = true
+	require.False(t, all.Match("/b"))
+	require.False(t, all.IsAll())
+}
+
+func TestNewNone(t *testing.T) {
+	none := NewNone()
+	require.False(t, none.Match("/a"))
+	require.True(t, none.IsNone())
+	require.False(t, none.IsAll())
+	require.True(t, NewInclude().IsNone())
+	require.False(t, NewInclude("/a").IsNone())
+
+	require.True(t, none.Add("/a").Match("/a"))
+	none.SetOperations([]Path{"/b"})
+	require.True(t, none.Match("/b"))
+	require.False(t, none.IsNone())
+}
@@ -0,0 +1,13 @@
+package testutils
+
+import (
+	"testing"
+
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+// AssertCoverage 断言 enforcer 记录的 operation 被 selectPath 覆盖的比例不低于要求，否则单测失败
+func AssertCoverage(t testing.TB, enforcer *authkratosroutes.CoverageEnforcer, selectPath *authkratosroutes.SelectPath) {
+	require.NoError(t, enforcer.CheckCoverage(selectPath))
+}
@@ -0,0 +1,16 @@
+package testutils
+
+import (
+	"testing"
+
+	"github.com/orzkratos/authkratos/authkratosroutes"
+)
+
+func TestAssertCoverage(t *testing.T) {
+	enforcer := authkratosroutes.NewCoverageEnforcer(1.0)
+	enforcer.Observe("/a")
+	enforcer.Observe("/b")
+
+	AssertCoverage(t, enforcer, authkratosroutes.NewInclude("/a", "/b"))
+	AssertCoverage(t, enforcer, authkratosroutes.NewAll())
+}
@@ -0,0 +1,35 @@
+package authkratosroutes
+
+import (
+	"strings"
+
+	"github.com/yyle88/erero"
+)
+
+// Validate 检查 operation 集合里是否有空的或者只有空白字符的 operation，这种 operation 通常是配置写错了
+func (c *SelectPath) Validate() error {
+	for _, path := range c.GetOperations() {
+		if strings.TrimSpace(string(path)) == "" {
+			return erero.Errorf("operation must not be blank but got %q", path)
+		}
+	}
+	return nil
+}
+
+// NewIncludeChecked 和 NewInclude 相同，但是 operation 不合法时返回错误
+func NewIncludeChecked(paths ...Path) (*SelectPath, error) {
+	selectPath := NewInclude(paths...)
+	if err := selectPath.Validate(); err != nil {
+		return nil, err
+	}
+	return selectPath, nil
+}
+
+// NewExcludeChecked 和 NewExclude 相同，但是 operation 不合法时返回错误
+func NewExcludeChecked(paths ...Path) (*SelectPath, error) {
+	selectPath := NewExclude(paths...)
+	if err := selectPath.Validate(); err != nil {
+		return nil, err
+	}
+	return selectPath, nil
+}
@@ -0,0 +1,32 @@
+package authkratosroutes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPath_Validate(t *testing.T) {
+	require.NoError(t, NewInclude("/a", "/b").Validate())
+	require.NoError(t, NewAll().Validate())
+	require.Error(t, NewInclude("/a", "").Validate())
+	require.Error(t, NewExclude(" \t").Validate())
+}
+
+func TestNewIncludeChecked(t *testing.T) {
+	selectPath, err := NewIncludeChecked("/a")
+	require.NoError(t, err)
+	require.True(t, selectPath.Match("/a"))
+
+	_, err = NewIncludeChecked("/a", "")
+	require.Error(t, err)
+}
+
+func TestNewExcludeChecked(t *testing.T) {
+	selectPath, err := NewExcludeChecked("/a")
+	require.NoError(t, err)
+	require.False(t, selectPath.Match("/a"))
+
+	_, err = NewExcludeChecked(" ")
+	require.Error(t, err)
+}
@@ -2,31 +2,80 @@ package authkratossimple
 
 import (
 	"context"
+	"math/rand"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
 	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
 	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/metrics"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yyle88/must"
 	"go.elastic.co/apm/v2"
 )
 
 type Config struct {
-	field      string
-	selectPath *authkratosroutes.SelectPath
-	check      CheckFunc
-	enable     bool
+	fields            []string
+	selectPath        authkratosroutes.Matcher
+	check             CheckFunc
+	enable            bool
+	extractors        []TokenExtractor
+	forwardKeys       []interface{}
+	grpcMdKeys        []string
+	logSampling       float64
+	cacheTTL          time.Duration
+	cacheSize         int
+	optional          bool
+	metrics           *metrics.Metrics
+	validationTimeout time.Duration
+
+	maxConcurrentValidations int
+	semaphoreTimeout         time.Duration
+	structuredLogging        bool
 }
 
+// 认证失败的原因，客户端可以按原因区分处理，比如 MISSING_TOKEN 时提示登录，INVALID_TOKEN 时清除本地的凭证
+const (
+	ReasonMissingToken = "MISSING_TOKEN" //请求里没有携带 token，由中间件返回
+	ReasonInvalidToken = "INVALID_TOKEN" //token 不正确，CheckFunc 里使用
+	ReasonExpiredToken = "EXPIRED_TOKEN" //token 已过期，CheckFunc 里使用
+)
+
+// CheckFunc 校验 token，失败时建议返回 errors.Unauthorized(ReasonInvalidToken, ...) 或 errors.Unauthorized(ReasonExpiredToken, ...)
 type CheckFunc func(ctx context.Context, token string) (context.Context, *errors.Error)
 
-func NewConfig(field string, check CheckFunc, selectPath *authkratosroutes.SelectPath) *Config {
+func NewConfig(field string, check CheckFunc, selectPath authkratosroutes.Matcher) *Config {
 	return &Config{
-		field:      field,
-		selectPath: selectPath,
-		check:      check,
-		enable:     true,
+		fields:      []string{field},
+		selectPath:  selectPath,
+		check:       check,
+		enable:      true,
+		logSampling: 1,
+	}
+}
+
+// NewChainedConfig 按顺序尝试多个校验函数，使用第一个通过的校验函数返回的上下文，全部失败时返回最后一个错误
+// 比如同时支持内部服务的 token 和用户的 JWT
+func NewChainedConfig(field string, selectPath authkratosroutes.Matcher, checks ...CheckFunc) *Config {
+	must.Have(checks)
+	return NewConfig(field, chainCheckFuncs(checks), selectPath)
+}
+
+func chainCheckFuncs(checks []CheckFunc) CheckFunc {
+	return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		var erk *errors.Error
+		for _, check := range checks {
+			var checkCtx context.Context
+			if checkCtx, erk = check(ctx, token); erk == nil {
+				return checkCtx, nil
+			}
+		}
+		return nil, erk
 	}
 }
 
@@ -36,14 +85,140 @@ func (a *Config) SetEnable(enable bool) {
 
 func (a *Config) IsEnable() bool {
 	if a != nil {
-		return a.enable && a.field != ""
+		return a.enable && (a.hasField() || len(a.extractors) > 0 || len(a.grpcMdKeys) > 0)
 	}
 	return false
 }
 
+// WithStructuredLogging 按请求打印认证结果的结构化 debug 日志，不受 WithRequestLogSampling 的抽样影响，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithExtractorChain 设置取 token 的方式，按顺序尝试，使用第一个不为空的结果
+// 不设置时从 fields 对应的请求头里取 token
+func (a *Config) WithExtractorChain(extractors ...TokenExtractor) *Config {
+	a.extractors = extractors
+	return a
+}
+
+// WithForwardContextKey 声明需要从校验函数返回的上下文里转发到请求上下文的 key，可以多次调用累加
+// 声明以后只转发这些 key 的值，校验函数设置的其它值不会传给后面的 handler
+// 不声明时保持原来的逻辑，直接使用校验函数返回的上下文
+func (a *Config) WithForwardContextKey(key interface{}) *Config {
+	a.forwardKeys = append(a.forwardKeys, key)
+	return a
+}
+
+func (a *Config) forwardContext(ctx context.Context, checkCtx context.Context) context.Context {
+	if len(a.forwardKeys) == 0 {
+		return checkCtx
+	}
+	for _, key := range a.forwardKeys {
+		if value := checkCtx.Value(key); value != nil {
+			ctx = context.WithValue(ctx, key, value)
+		}
+	}
+	return ctx
+}
+
+// WithGRPCMetadataKeys 设置 grpc 请求时从 metadata 里取 token 的 key，按顺序尝试，使用第一个不为空的结果
+// 仅对 grpc 请求生效，http 请求依然使用 fields 或 WithExtractorChain 设置的方式
+func (a *Config) WithGRPCMetadataKeys(keys ...string) *Config {
+	a.grpcMdKeys = keys
+	return a
+}
+
+// WithOptionalAuth 请求没有携带 token 时直接放行，携带了 token 时依然需要通过校验
+// 适合登录和未登录都能访问的接口，比如登录时展示个性化内容，通常和 authkratosroutes.NewAll 一起使用
+func (a *Config) WithOptionalAuth() *Config {
+	a.optional = true
+	return a
+}
+
+// WithMetrics 统计认证结果到 authkratos_auth_requests_total{operation,result} 指标，第一次请求时才注册
+// WithOptionalAuth 放行的没有 token 的请求不计数
+func (a *Config) WithMetrics(reg prometheus.Registerer) *Config {
+	a.metrics = metrics.New(reg)
+	return a
+}
+
+// WithRequestLogSampling 按概率打印中间件的 debug 日志，比如设置0.01就是只打印1%请求的日志，设置1就是全部打印
+// 高并发的接口即使只打 debug 日志也很多，因此可以抽样打印
+func (a *Config) WithRequestLogSampling(sampleRate float64) *Config {
+	a.logSampling = sampleRate
+	return a
+}
+
+func (a *Config) sampleDebugLog() bool {
+	return a.logSampling >= 1 || rand.Float64() < a.logSampling
+}
+
+func (a *Config) extractToken(tp transport.Transporter) string {
+	if tp.Kind() == transport.KindGRPC && len(a.grpcMdKeys) > 0 {
+		for _, key := range a.grpcMdKeys {
+			if token := tp.RequestHeader().Get(key); token != "" {
+				return token
+			}
+		}
+		return ""
+	}
+	if len(a.extractors) == 0 {
+		return a.getHeaderToken(tp.RequestHeader())
+	}
+	for _, extractor := range a.extractors {
+		if token := extractor.Extract(tp); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// GetField 返回第一个请求头的名称，兼容只设置一个请求头的老代码
 func (a *Config) GetField() string {
+	if a != nil && len(a.fields) > 0 {
+		return a.fields[0]
+	}
+	return ""
+}
+
+// GetFieldNames 返回取 token 的请求头名称列表
+func (a *Config) GetFieldNames() []string {
 	if a != nil {
-		return a.field
+		return a.fields
+	}
+	return nil
+}
+
+// WithFieldName 设置取 token 的请求头名称，会覆盖之前设置的全部请求头
+func (a *Config) WithFieldName(name string) *Config {
+	return a.WithFieldNames(name)
+}
+
+// WithFieldNames 设置多个取 token 的请求头名称，按顺序尝试，使用第一个不为空的值
+func (a *Config) WithFieldNames(names ...string) *Config {
+	a.fields = names
+	return a
+}
+
+func (a *Config) hasField() bool {
+	for _, name := range a.fields {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Config) getHeaderToken(header transport.Header) string {
+	for _, name := range a.fields {
+		if name == "" {
+			continue
+		}
+		if token := header.Get(name); token != "" {
+			return token
+		}
 	}
 	return ""
 }
@@ -51,14 +226,15 @@ func (a *Config) GetField() string {
 func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 	LOG.Infof(
-		"new check_auth middleware enable=%v field=%v simple=x include=%v operations=%v",
+		"new check_auth middleware enable=%v field=%v simple=x include=%v operations=%v version=%v",
 		cfg.IsEnable(),
-		cfg.field,
-		cfg.selectPath.SelectSide,
-		len(cfg.selectPath.Operations),
+		cfg.fields,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
 	)
 
-	return selector.Server(middlewareFunc(cfg, LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+	return selector.Server(structlog.Wrap("auth_kratos_simple", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
 }
 
 func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
@@ -69,10 +245,12 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 			return false
 		}
 		match := cfg.selectPath.Match(operation)
-		if match {
-			LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, cfg.selectPath.SelectSide, match)
-		} else {
-			LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, cfg.selectPath.SelectSide, match)
+		if cfg.sampleDebugLog() {
+			if match {
+				LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			} else {
+				LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+			}
 		}
 		return match
 	}
@@ -81,6 +259,21 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 
+	var check = cfg.check
+	if cfg.validationTimeout > 0 {
+		check = withTimeoutCheck(check, cfg.validationTimeout)
+	}
+	if cfg.maxConcurrentValidations > 0 {
+		check = withConcurrencyLimit(check, cfg.maxConcurrentValidations, cfg.semaphoreTimeout)
+	}
+	if cfg.cacheTTL > 0 {
+		cache := newCheckCache(cfg.cacheTTL, cfg.cacheSize)
+		var uncached = check
+		check = func(ctx context.Context, token string) (context.Context, *errors.Error) {
+			return cache.check(ctx, token, uncached)
+		}
+	}
+
 	return func(handleFunc middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
 			if !cfg.IsEnable() {
@@ -92,15 +285,24 @@ func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 				sp := apmTx.StartSpan("auth_kratos_simple", "auth", nil)
 				defer sp.End()
 
-				token := tp.RequestHeader().Get(cfg.field)
+				token := cfg.extractToken(tp)
 				if token == "" {
-					return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_simple: auth token is missing")
+					if cfg.optional {
+						if cfg.sampleDebugLog() {
+							LOG.Debugf("auth_kratos_simple: auth token is missing optional pass")
+						}
+						return handleFunc(ctx, req)
+					}
+					cfg.metrics.IncAuthRequest(tp.Operation(), metrics.ResultFailure)
+					return nil, errors.Unauthorized(ReasonMissingToken, "auth_kratos_simple: auth token is missing")
 				}
-				ctx, erk := cfg.check(ctx, token)
+				checkCtx, erk := check(ctx, token)
 				if erk != nil {
+					cfg.metrics.IncAuthRequest(tp.Operation(), metrics.ResultFailure)
 					return nil, erk
 				}
-				return handleFunc(ctx, req)
+				cfg.metrics.IncAuthRequest(tp.Operation(), metrics.ResultSuccess)
+				return handleFunc(cfg.forwardContext(ctx, checkCtx), req)
 			}
 			return nil, errors.Unauthorized("UNAUTHORIZED", "auth_kratos_simple: wrong context for middleware")
 		}
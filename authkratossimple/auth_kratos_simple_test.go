@@ -1,9 +1,244 @@
 package authkratossimple
 
 import (
+	"context"
+	"strings"
 	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
 	m.Run()
 }
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return ctx, nil
+}
+
+// callWithHeader 模拟带请求头的请求，返回 handler 收到的上下文
+func callWithHeader(mw middleware.Middleware, operation string, key string, value string) (context.Context, *errors.Error) {
+	tp := kratosmock.NewHTTPTransport(operation)
+	if value != "" {
+		tp.WithHeader(key, value)
+	}
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		return nil, errors.FromError(err)
+	}
+	return res.(context.Context), nil
+}
+
+type forwardKey struct{}
+
+type otherKey struct{}
+
+func TestConfig_WithForwardContextKey(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		ctx = context.WithValue(ctx, forwardKey{}, "forward-"+token)
+		ctx = context.WithValue(ctx, otherKey{}, "other-"+token)
+		return ctx, nil
+	}
+
+	mw := NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")), log.DefaultLogger)
+	ctx, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+	require.Nil(t, erk)
+	require.Equal(t, "forward-abc", ctx.Value(forwardKey{}))
+	require.Equal(t, "other-abc", ctx.Value(otherKey{}))
+
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")).WithForwardContextKey(forwardKey{})
+	mw = NewMiddleware(cfg, log.DefaultLogger)
+	ctx, erk = callWithHeader(mw, "/a", "Authorization", "abc")
+	require.Nil(t, erk)
+	require.Equal(t, "forward-abc", ctx.Value(forwardKey{}))
+	require.Nil(t, ctx.Value(otherKey{}))
+}
+
+// countLogger 统计各个级别的日志条数
+type countLogger struct {
+	counts map[log.Level]int
+}
+
+func (l *countLogger) Log(level log.Level, keyvals ...interface{}) error {
+	l.counts[level]++
+	return nil
+}
+
+func TestConfig_WithRequestLogSampling(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		return ctx, nil
+	}
+
+	LOGGER := &countLogger{counts: map[log.Level]int{}}
+	mw := NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")), LOGGER)
+	for idx := 0; idx < 10; idx++ {
+		_, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+		require.Nil(t, erk)
+	}
+	require.Equal(t, 10, LOGGER.counts[log.LevelDebug])
+
+	LOGGER = &countLogger{counts: map[log.Level]int{}}
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")).WithRequestLogSampling(0)
+	mw = NewMiddleware(cfg, LOGGER)
+	for idx := 0; idx < 10; idx++ {
+		_, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+		require.Nil(t, erk)
+	}
+	require.Equal(t, 0, LOGGER.counts[log.LevelDebug])
+}
+
+func TestConfig_WithFieldNames(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		if token != "abc" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong")
+		}
+		return ctx, nil
+	}
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")).WithFieldNames("Authorization", "X-Api-Key")
+	require.Equal(t, "Authorization", cfg.GetField())
+	require.Equal(t, []string{"Authorization", "X-Api-Key"}, cfg.GetFieldNames())
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+	require.Nil(t, erk)
+	_, erk = callWithHeader(mw, "/a", "X-Api-Key", "abc")
+	require.Nil(t, erk)
+	_, erk = callWithHeader(mw, "/a", "X-Other", "abc")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Contains(t, erk.Message, "missing")
+
+	cfg = NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")).WithFieldName("X-Api-Key")
+	require.Equal(t, []string{"X-Api-Key"}, cfg.GetFieldNames())
+	_, erk = callWithHeader(NewMiddleware(cfg, log.DefaultLogger), "/a", "Authorization", "abc")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestNewChainedConfig(t *testing.T) {
+	var calls []string
+	newCheck := func(name string, prefix string) CheckFunc {
+		return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+			calls = append(calls, name)
+			if len(token) < len(prefix) || token[:len(prefix)] != prefix {
+				return nil, errors.Unauthorized("UNAUTHORIZED", name+" wrong")
+			}
+			return context.WithValue(ctx, forwardKey{}, name), nil
+		}
+	}
+	cfg := NewChainedConfig("Authorization", authkratosroutes.NewInclude("/a"), newCheck("service", "svc-"), newCheck("user", "svc-user-"), newCheck("jwt", "jwt-"))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx, erk := callWithHeader(mw, "/a", "Authorization", "svc-user-abc")
+	require.Nil(t, erk)
+	require.Equal(t, "service", ctx.Value(forwardKey{}))
+	require.Equal(t, []string{"service"}, calls)
+
+	calls = nil
+	ctx, erk = callWithHeader(mw, "/a", "Authorization", "jwt-abc")
+	require.Nil(t, erk)
+	require.Equal(t, "jwt", ctx.Value(forwardKey{}))
+	require.Equal(t, []string{"service", "user", "jwt"}, calls)
+
+	calls = nil
+	_, erk = callWithHeader(mw, "/a", "Authorization", "abc")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Equal(t, "jwt wrong", erk.Message)
+	require.Equal(t, []string{"service", "user", "jwt"}, calls)
+}
+
+func TestConfig_WithOptionalAuth(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		if token != "abc" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong")
+		}
+		return context.WithValue(ctx, forwardKey{}, "alice"), nil
+	}
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewAll()).WithOptionalAuth()
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx, erk := callWithHeader(mw, "/a", "Authorization", "")
+	require.Nil(t, erk)
+	require.Nil(t, ctx.Value(forwardKey{}))
+
+	ctx, erk = callWithHeader(mw, "/a", "Authorization", "abc")
+	require.Nil(t, erk)
+	require.Equal(t, "alice", ctx.Value(forwardKey{}))
+
+	_, erk = callWithHeader(mw, "/a", "Authorization", "wrong")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	_, erk = callWithHeader(NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewAll()), log.DefaultLogger), "/a", "Authorization", "")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestConfig_WithMetrics(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		if token != "abc" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong")
+		}
+		return ctx, nil
+	}
+	reg := prometheus.NewRegistry()
+	mw := NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewAll()).WithMetrics(reg), log.DefaultLogger)
+
+	for idx := 0; idx < 2; idx++ {
+		_, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+		require.Nil(t, erk)
+	}
+	_, erk := callWithHeader(mw, "/a", "Authorization", "wrong")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithHeader(mw, "/b", "Authorization", "abc")
+	require.Nil(t, erk)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP authkratos_auth_requests_total Total number of requests checked by authkratos middlewares.
+# TYPE authkratos_auth_requests_total counter
+authkratos_auth_requests_total{operation="/a",result="failure"} 1
+authkratos_auth_requests_total{operation="/a",result="success"} 2
+authkratos_auth_requests_total{operation="/b",result="success"} 1
+`), "authkratos_auth_requests_total"))
+}
+
+func TestNewMiddleware_ErrorReasons(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		switch token {
+		case "abc":
+			return ctx, nil
+		case "old":
+			return nil, errors.Unauthorized(ReasonExpiredToken, "token is expired")
+		default:
+			return nil, errors.Unauthorized(ReasonInvalidToken, "token is wrong")
+		}
+	}
+	mw := NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewAll()), log.DefaultLogger)
+
+	for _, newTransport := range []func(string) *kratosmock.Transport{kratosmock.NewHTTPTransport, kratosmock.NewGRPCTransport} {
+		callOnce := func(token string) *errors.Error {
+			tp := newTransport("/a")
+			if token != "" {
+				tp.WithHeader("Authorization", token)
+			}
+			_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+			return errors.FromError(err)
+		}
+		require.Nil(t, callOnce("abc"))
+
+		erk := callOnce("")
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Equal(t, ReasonMissingToken, erk.Reason)
+
+		erk = callOnce("wrong")
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Equal(t, ReasonInvalidToken, erk.Reason)
+
+		erk = callOnce("old")
+		require.True(t, errors.IsUnauthorized(erk))
+		require.Equal(t, ReasonExpiredToken, erk.Reason)
+	}
+}
@@ -0,0 +1,134 @@
+package authkratossimple
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/yyle88/must"
+)
+
+// WithCache 缓存校验通过的结果，ttl 时长内同一个 token 的请求不再调用校验函数，适合校验函数需要访问数据库或者认证服务的场景
+// 校验失败的结果不缓存
+// 命中缓存时使用校验函数设置到上下文里的值，超时和取消依然使用当前请求的上下文
+func (a *Config) WithCache(ttl time.Duration) *Config {
+	must.TRUE(ttl > 0)
+	a.cacheTTL = ttl
+	return a
+}
+
+// WithCacheSize 限制缓存的 token 数量，超过时淘汰最久没有使用的 token，不设置时不限制数量
+func (a *Config) WithCacheSize(n int) *Config {
+	must.TRUE(n > 0)
+	a.cacheSize = n
+	return a
+}
+
+// cachedResult 是缓存的校验结果，checkCtx 里 boundary 以上的值是校验函数设置的
+type cachedResult struct {
+	token     string
+	checkCtx  context.Context
+	expiresAt time.Time
+}
+
+// checkCache 是按 LRU 淘汰的缓存
+type checkCache struct {
+	ttl     time.Duration
+	size    int
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newCheckCache(ttl time.Duration, size int) *checkCache {
+	return &checkCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *checkCache) get(token string) (context.Context, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[token]
+	if !ok {
+		return nil, false
+	}
+	result := element.Value.(*cachedResult)
+	if time.Now().After(result.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, token)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return result.checkCtx, true
+}
+
+func (c *checkCache) put(token string, checkCtx context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	result := &cachedResult{token: token, checkCtx: checkCtx, expiresAt: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[token]; ok {
+		element.Value = result
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[token] = c.order.PushFront(result)
+	if c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).token)
+	}
+}
+
+// check 先查缓存，没有时调用校验函数，返回的上下文的值来自校验函数，超时和取消来自当前请求
+func (c *checkCache) check(ctx context.Context, token string, check CheckFunc) (context.Context, *errors.Error) {
+	if checkCtx, ok := c.get(token); ok {
+		return &mergedContext{Context: ctx, checkCtx: checkCtx}, nil
+	}
+	boundary := &cacheBoundary{Context: ctx}
+	checkCtx, erk := check(boundary, token)
+	if erk != nil {
+		return nil, erk
+	}
+	boundary.sealed.Store(true)
+	c.put(token, checkCtx)
+	return &mergedContext{Context: ctx, checkCtx: checkCtx}, nil
+}
+
+// boundaryMiss 表示在校验函数设置的值里没有找到
+type boundaryMiss struct{}
+
+// cacheBoundary 标记校验函数收到的上下文，校验结束以后不再返回第一次请求的值，这样缓存的上下文只包含校验函数设置的值
+type cacheBoundary struct {
+	context.Context
+	sealed atomic.Bool
+}
+
+func (b *cacheBoundary) Value(key interface{}) interface{} {
+	if b.sealed.Load() {
+		return boundaryMiss{}
+	}
+	return b.Context.Value(key)
+}
+
+// mergedContext 优先使用校验函数设置的值，其余的值、超时和取消都来自当前请求
+type mergedContext struct {
+	context.Context
+	checkCtx context.Context
+}
+
+func (m *mergedContext) Value(key interface{}) interface{} {
+	value := m.checkCtx.Value(key)
+	if _, miss := value.(boundaryMiss); miss {
+		return m.Context.Value(key)
+	}
+	return value
+}
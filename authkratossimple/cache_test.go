@@ -0,0 +1,97 @@
+package authkratossimple
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+type usernameKey struct{}
+
+// newCountingCheck 返回会统计调用次数的校验函数，token 是 "token-" 开头时通过
+func newCountingCheck(count *int) CheckFunc {
+	return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		*count++
+		if len(token) < 6 || token[:6] != "token-" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong")
+		}
+		return context.WithValue(ctx, usernameKey{}, token[6:]), nil
+	}
+}
+
+func TestConfig_WithCache(t *testing.T) {
+	var count int
+	cfg := NewConfig("Authorization", newCountingCheck(&count), authkratosroutes.NewInclude("/a")).WithCache(100 * time.Millisecond)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx, erk := callWithHeader(mw, "/a", "Authorization", "token-alice")
+	require.Nil(t, erk)
+	require.Equal(t, "alice", ctx.Value(usernameKey{}))
+	require.Equal(t, 1, count)
+
+	ctx, erk = callWithHeader(mw, "/a", "Authorization", "token-alice")
+	require.Nil(t, erk)
+	require.Equal(t, "alice", ctx.Value(usernameKey{}))
+	require.Equal(t, 1, count)
+
+	//命中缓存时 transport 等其它值依然来自当前请求
+	tp, ok := transport.FromServerContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "token-alice", tp.RequestHeader().Get("Authorization"))
+
+	//校验失败的结果不缓存
+	for idx := 0; idx < 2; idx++ {
+		_, erk = callWithHeader(mw, "/a", "Authorization", "wrong")
+		require.True(t, errors.IsUnauthorized(erk))
+	}
+	require.Equal(t, 3, count)
+
+	time.Sleep(150 * time.Millisecond)
+	_, erk = callWithHeader(mw, "/a", "Authorization", "token-alice")
+	require.Nil(t, erk)
+	require.Equal(t, 4, count)
+}
+
+func TestConfig_WithCacheSize(t *testing.T) {
+	var count int
+	cfg := NewConfig("Authorization", newCountingCheck(&count), authkratosroutes.NewInclude("/a")).WithCache(time.Minute).WithCacheSize(2)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for _, token := range []string{"token-a", "token-b", "token-a", "token-c"} {
+		_, erk := callWithHeader(mw, "/a", "Authorization", token)
+		require.Nil(t, erk)
+	}
+	require.Equal(t, 3, count)
+
+	//token-b 最久没有使用因此被淘汰
+	_, erk := callWithHeader(mw, "/a", "Authorization", "token-a")
+	require.Nil(t, erk)
+	require.Equal(t, 3, count)
+	_, erk = callWithHeader(mw, "/a", "Authorization", "token-b")
+	require.Nil(t, erk)
+	require.Equal(t, 4, count)
+}
+
+func TestConfig_WithCache_Cancel(t *testing.T) {
+	var count int
+	cfg := NewConfig("Authorization", newCountingCheck(&count), authkratosroutes.NewInclude("/a")).WithCache(time.Minute)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithHeader(mw, "/a", "Authorization", "token-alice")
+	require.Nil(t, erk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("Authorization", "token-alice")
+	res, err := mw(handleFunc)(tp.NewContext(ctx), nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.ErrorIs(t, res.(context.Context).Err(), context.Canceled)
+}
@@ -0,0 +1,58 @@
+package authkratossimple
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/yyle88/must"
+)
+
+// ReasonAuthConcurrencyExceeded 同时调用校验函数的请求超过 WithMaxConcurrentValidations 设置的数量时返回 503 和这个原因
+const ReasonAuthConcurrencyExceeded = "AUTH_CONCURRENCY_EXCEEDED"
+
+// WithMaxConcurrentValidations 限制同时调用校验函数的请求数量，避免认证服务恢复时积压的请求同时打过去
+// 拿不到名额的请求直接返回 503，和 WithCache 一起使用时命中缓存的请求不占用名额
+func (a *Config) WithMaxConcurrentValidations(n int) *Config {
+	must.TRUE(n > 0)
+	a.maxConcurrentValidations = n
+	return a
+}
+
+// WithSemaphoreTimeout 拿不到名额时最多等待的时长，等待期间有请求校验完成就能继续，默认不等待
+// 认证服务只是暂时繁忙时请求能等到名额，一直拿不到名额时说明认证服务不可用
+func (a *Config) WithSemaphoreTimeout(d time.Duration) *Config {
+	must.TRUE(d > 0)
+	a.semaphoreTimeout = d
+	return a
+}
+
+// withConcurrencyLimit 使用 chan 作为信号量限制同时调用校验函数的数量
+func withConcurrencyLimit(check CheckFunc, n int, timeout time.Duration) CheckFunc {
+	semaphore := make(chan struct{}, n)
+	erkBusy := errors.New(http.StatusServiceUnavailable, ReasonAuthConcurrencyExceeded, "auth_kratos_simple: too many concurrent validations")
+
+	return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		select {
+		case semaphore <- struct{}{}:
+		default:
+			if timeout <= 0 {
+				return nil, erkBusy
+			}
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			select {
+			case semaphore <- struct{}{}:
+			case <-timer.C:
+				return nil, erkBusy
+			case <-ctx.Done():
+				return nil, erkBusy
+			}
+		}
+		defer func() {
+			<-semaphore
+		}()
+		return check(ctx, token)
+	}
+}
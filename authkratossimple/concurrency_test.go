@@ -0,0 +1,85 @@
+package authkratossimple
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+// slowChecker 模拟很慢的认证服务，记录同时在校验的最大请求数
+type slowChecker struct {
+	delay    time.Duration
+	running  atomic.Int32
+	maxCount atomic.Int32
+}
+
+func (c *slowChecker) check(ctx context.Context, token string) (context.Context, *errors.Error) {
+	count := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		old := c.maxCount.Load()
+		if count <= old || c.maxCount.CompareAndSwap(old, count) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	return ctx, nil
+}
+
+// callConcurrently 同时发出 count 个请求，返回通过和返回 AUTH_CONCURRENCY_EXCEEDED 的数量
+func callConcurrently(t *testing.T, cfg *Config, count int) (int, int) {
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	var passed, rejected atomic.Int32
+	var wg sync.WaitGroup
+	for idx := 0; idx < count; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+			if erk == nil {
+				passed.Add(1)
+				return
+			}
+			require.Equal(t, int32(http.StatusServiceUnavailable), erk.Code)
+			require.Equal(t, ReasonAuthConcurrencyExceeded, erk.Reason)
+			rejected.Add(1)
+		}()
+	}
+	wg.Wait()
+	return int(passed.Load()), int(rejected.Load())
+}
+
+func TestConfig_WithMaxConcurrentValidations(t *testing.T) {
+	checker := &slowChecker{delay: 100 * time.Millisecond}
+	cfg := NewConfig("Authorization", checker.check, authkratosroutes.NewAll()).WithMaxConcurrentValidations(3)
+
+	passed, rejected := callConcurrently(t, cfg, 20)
+	require.Equal(t, int32(3), checker.maxCount.Load())
+	require.Equal(t, 3, passed)
+	require.Equal(t, 17, rejected)
+}
+
+func TestConfig_WithSemaphoreTimeout(t *testing.T) {
+	checker := &slowChecker{delay: 20 * time.Millisecond}
+	cfg := NewConfig("Authorization", checker.check, authkratosroutes.NewAll()).WithMaxConcurrentValidations(3).WithSemaphoreTimeout(5 * time.Second)
+
+	passed, rejected := callConcurrently(t, cfg, 20)
+	require.Equal(t, int32(3), checker.maxCount.Load())
+	require.Equal(t, 20, passed)
+	require.Equal(t, 0, rejected)
+
+	//等待超时以后依然拿不到名额时返回 503
+	checker = &slowChecker{delay: 200 * time.Millisecond}
+	cfg = NewConfig("Authorization", checker.check, authkratosroutes.NewAll()).WithMaxConcurrentValidations(1).WithSemaphoreTimeout(20 * time.Millisecond)
+	passed, rejected = callConcurrently(t, cfg, 5)
+	require.Equal(t, 1, passed)
+	require.Equal(t, 4, rejected)
+}
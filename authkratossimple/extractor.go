@@ -0,0 +1,58 @@
+package authkratossimple
+
+import (
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// TokenExtractor 从请求里取 token，取不到时返回空字符串
+type TokenExtractor interface {
+	Extract(tp transport.Transporter) string
+}
+
+type headerExtractor struct {
+	name string
+}
+
+// HeaderExtractor 从请求头里取 token，http 和 grpc 都能用
+func HeaderExtractor(name string) TokenExtractor {
+	return &headerExtractor{name: name}
+}
+
+func (e *headerExtractor) Extract(tp transport.Transporter) string {
+	return tp.RequestHeader().Get(e.name)
+}
+
+type cookieExtractor struct {
+	name string
+}
+
+// CookieExtractor 从 cookie 里取 token，仅 http 请求有效
+func CookieExtractor(name string) TokenExtractor {
+	return &cookieExtractor{name: name}
+}
+
+func (e *cookieExtractor) Extract(tp transport.Transporter) string {
+	if htp, ok := tp.(http.Transporter); ok && htp.Request() != nil {
+		if cookie, err := htp.Request().Cookie(e.name); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+type queryExtractor struct {
+	name string
+}
+
+// QueryExtractor 从 url 的 query 参数里取 token，仅 http 请求有效
+func QueryExtractor(name string) TokenExtractor {
+	return &queryExtractor{name: name}
+}
+
+func (e *queryExtractor) Extract(tp transport.Transporter) string {
+	if htp, ok := tp.(http.Transporter); ok && htp.Request() != nil {
+		return htp.Request().URL.Query().Get(e.name)
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package authkratossimple
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithExtractorChain(t *testing.T) {
+	var tokens []string
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		tokens = append(tokens, token)
+		return ctx, nil
+	}
+	cfg := NewConfig("", check, authkratosroutes.NewInclude("/a")).WithExtractorChain(
+		HeaderExtractor("X-Api-Key"),
+		CookieExtractor("token"),
+		QueryExtractor("token"),
+	)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	testCases := []struct {
+		header string
+		cookie string
+		query  string
+		token  string
+	}{
+		{header: "h", cookie: "c", query: "q", token: "h"},
+		{header: "h", cookie: "c", token: "h"},
+		{header: "h", query: "q", token: "h"},
+		{cookie: "c", query: "q", token: "c"},
+		{header: "h", token: "h"},
+		{cookie: "c", token: "c"},
+		{query: "q", token: "q"},
+	}
+	for _, tc := range testCases {
+		tp := kratosmock.NewHTTPTransport("/a")
+		if tc.header != "" {
+			tp.WithHeader("X-Api-Key", tc.header)
+		}
+		if tc.cookie != "" {
+			tp.Request().AddCookie(&http.Cookie{Name: "token", Value: tc.cookie})
+		}
+		if tc.query != "" {
+			tp.Request().URL.RawQuery = "token=" + tc.query
+		}
+		tokens = nil
+		_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{tc.token}, tokens)
+	}
+
+	tokens = nil
+	_, erk := callWithHeader(mw, "/a", "Authorization", "h")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Empty(t, tokens)
+}
+
+func TestCookieExtractor_GRPC(t *testing.T) {
+	tp := kratosmock.NewGRPCTransport("/a").WithHeader("token", "g")
+	require.Empty(t, CookieExtractor("token").Extract(tp))
+	require.Empty(t, QueryExtractor("token").Extract(tp))
+	require.Equal(t, "g", HeaderExtractor("token").Extract(tp))
+}
+
+func TestConfig_WithGRPCMetadataKeys(t *testing.T) {
+	var tokens []string
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		tokens = append(tokens, token)
+		return ctx, nil
+	}
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewInclude("/a")).WithGRPCMetadataKeys("x-auth-token", "x-api-key")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	testCases := []struct {
+		metadata map[string]string
+		token    string
+	}{
+		{metadata: map[string]string{"x-auth-token": "t1", "x-api-key": "t2", "Authorization": "t3"}, token: "t1"},
+		{metadata: map[string]string{"x-api-key": "t2", "Authorization": "t3"}, token: "t2"},
+	}
+	for _, tc := range testCases {
+		tp := kratosmock.NewGRPCTransport("/a")
+		for key, value := range tc.metadata {
+			tp.WithHeader(key, value)
+		}
+		tokens = nil
+		_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{tc.token}, tokens)
+	}
+
+	//没有配置的 key 不会被使用
+	tp := kratosmock.NewGRPCTransport("/a").WithHeader("Authorization", "t3")
+	_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	require.True(t, errors.IsUnauthorized(err))
+
+	//http 请求依然使用 field
+	tokens = nil
+	_, erk := callWithHeader(mw, "/a", "Authorization", "t3")
+	require.Nil(t, erk)
+	require.Equal(t, []string{"t3"}, tokens)
+}
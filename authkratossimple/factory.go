@@ -0,0 +1,59 @@
+package authkratossimple
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+)
+
+// MiddlewareFactory 按 operation 选择不同的配置，没有单独配置的 operation 使用默认配置
+// 当接口很多而少数接口需要不同的 field 或校验函数时使用
+type MiddlewareFactory struct {
+	defaultCfg *Config
+	overrides  map[authkratosroutes.Path]*Config
+}
+
+func NewMiddlewareFactory(defaultCfg *Config) *MiddlewareFactory {
+	return &MiddlewareFactory{
+		defaultCfg: defaultCfg,
+		overrides:  map[authkratosroutes.Path]*Config{},
+	}
+}
+
+// WithOperationOverride 给某个 operation 设置单独的配置，该 operation 总是按这个配置认证，配置自身的 selectPath 不生效
+// 避免 selectPath 没有包含这个 operation 时跳过认证
+func (f *MiddlewareFactory) WithOperationOverride(operation string, cfg *Config) *MiddlewareFactory {
+	f.overrides[authkratosroutes.New(operation)] = cfg
+	return f
+}
+
+func (f *MiddlewareFactory) NewMiddleware(LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	defaultMiddleware := NewMiddleware(f.defaultCfg, LOGGER)
+	var middlewares = make(map[authkratosroutes.Path]middleware.Middleware, len(f.overrides))
+	for path, cfg := range f.overrides {
+		LOG.Infof("new check_auth override middleware enable=%v field=%v operation=%s", cfg.IsEnable(), cfg.fields, path)
+		//这里已经按 operation 选择了配置，因此不再经过 selectPath 的匹配，直接认证
+		middlewares[path] = structlog.Wrap("auth_kratos_simple", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)
+	}
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		defaultHandler := defaultMiddleware(handleFunc)
+		var handlers = make(map[authkratosroutes.Path]middleware.Handler, len(middlewares))
+		for path, mw := range middlewares {
+			handlers[path] = mw(handleFunc)
+		}
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				if handler, ok := handlers[authkratosroutes.New(tp.Operation())]; ok {
+					return handler(ctx, req)
+				}
+			}
+			return defaultHandler(ctx, req)
+		}
+	}
+}
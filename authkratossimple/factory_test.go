@@ -0,0 +1,57 @@
+package authkratossimple
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareFactory(t *testing.T) {
+	newCheck := func(expected string) CheckFunc {
+		return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+			if token != expected {
+				return nil, errors.Unauthorized("UNAUTHORIZED", "wrong token")
+			}
+			return ctx, nil
+		}
+	}
+	selectPath := authkratosroutes.NewInclude("/a", "/b")
+
+	factory := NewMiddlewareFactory(NewConfig("Authorization", newCheck("token-a"), selectPath)).
+		WithOperationOverride("/b", NewConfig("X-Api-Key", newCheck("token-b"), selectPath))
+	mw := factory.NewMiddleware(log.DefaultLogger)
+
+	_, erk := callWithHeader(mw, "/a", "Authorization", "token-a")
+	require.Nil(t, erk)
+	_, erk = callWithHeader(mw, "/a", "Authorization", "token-b")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	_, erk = callWithHeader(mw, "/b", "X-Api-Key", "token-b")
+	require.Nil(t, erk)
+	_, erk = callWithHeader(mw, "/b", "Authorization", "token-a")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestMiddlewareFactory_OverrideSelectPath(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		if token != "token-b" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong token")
+		}
+		return ctx, nil
+	}
+	//覆盖配置的 selectPath 不包含 /b 时依然需要认证
+	factory := NewMiddlewareFactory(NewConfig("Authorization", check, authkratosroutes.NewAll())).
+		WithOperationOverride("/b", NewConfig("X-Api-Key", check, authkratosroutes.NewNone()))
+	mw := factory.NewMiddleware(log.DefaultLogger)
+
+	_, erk := callWithHeader(mw, "/b", "X-Api-Key", "token-a")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithHeader(mw, "/b", "Authorization", "token-b")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithHeader(mw, "/b", "X-Api-Key", "token-b")
+	require.Nil(t, erk)
+}
@@ -0,0 +1,38 @@
+package authkratossimple
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/yyle88/must"
+)
+
+// ReasonAuthTimeout 校验函数超过 WithValidationTimeout 设置的时长时返回 503 和这个原因，而不是 401
+const ReasonAuthTimeout = "AUTH_TIMEOUT"
+
+// WithValidationTimeout 限制每次调用校验函数的时长，适合校验函数需要访问认证服务的场景，避免认证服务变慢时拖住全部请求
+// 校验函数需要使用传入的上下文，超时时上下文会被取消，和 WithCache 一起使用时命中缓存的请求不受影响
+func (a *Config) WithValidationTimeout(d time.Duration) *Config {
+	must.TRUE(d > 0)
+	a.validationTimeout = d
+	return a
+}
+
+// withTimeoutCheck 使用带超时的上下文调用校验函数，返回的上下文的值来自校验函数，超时和取消依然来自当前请求
+func withTimeoutCheck(check CheckFunc, timeout time.Duration) CheckFunc {
+	return func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		timeoutCtx, can := context.WithTimeout(ctx, timeout)
+		defer can()
+
+		checkCtx, erk := check(timeoutCtx, token)
+		if erk != nil {
+			if errors.Is(erk, context.DeadlineExceeded) || errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+				return nil, errors.New(http.StatusServiceUnavailable, ReasonAuthTimeout, "auth_kratos_simple: check token timeout")
+			}
+			return nil, erk
+		}
+		return &mergedContext{Context: ctx, checkCtx: checkCtx}, nil
+	}
+}
@@ -0,0 +1,66 @@
+package authkratossimple
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithValidationTimeout(t *testing.T) {
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		if token == "slow" {
+			<-ctx.Done()
+			return nil, errors.FromError(ctx.Err())
+		}
+		if token == "abc" {
+			return context.WithValue(ctx, forwardKey{}, "alice"), nil
+		}
+		return nil, errors.Unauthorized(ReasonInvalidToken, "wrong")
+	}
+	const timeout = 50 * time.Millisecond
+	mw := NewMiddleware(NewConfig("Authorization", check, authkratosroutes.NewAll()).WithValidationTimeout(timeout), log.DefaultLogger)
+
+	startTime := time.Now()
+	_, erk := callWithHeader(mw, "/a", "Authorization", "slow")
+	require.GreaterOrEqual(t, time.Since(startTime), timeout)
+	require.Less(t, time.Since(startTime), 10*timeout)
+	require.Equal(t, int32(http.StatusServiceUnavailable), erk.Code)
+	require.Equal(t, ReasonAuthTimeout, erk.Reason)
+
+	_, erk = callWithHeader(mw, "/a", "Authorization", "wrong")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//校验通过以后 handler 收到的上下文不带校验的超时
+	ctx, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+	require.Nil(t, erk)
+	require.Equal(t, "alice", ctx.Value(forwardKey{}))
+	_, hasDeadline := ctx.Deadline()
+	require.False(t, hasDeadline)
+	time.Sleep(timeout)
+	require.NoError(t, ctx.Err())
+}
+
+func TestConfig_WithValidationTimeout_WithCache(t *testing.T) {
+	var calls int
+	check := func(ctx context.Context, token string) (context.Context, *errors.Error) {
+		calls++
+		return context.WithValue(ctx, forwardKey{}, token), nil
+	}
+	cfg := NewConfig("Authorization", check, authkratosroutes.NewAll()).WithValidationTimeout(time.Second).WithCache(time.Minute)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 3; idx++ {
+		ctx, erk := callWithHeader(mw, "/a", "Authorization", "abc")
+		require.Nil(t, erk)
+		require.Equal(t, "abc", ctx.Value(forwardKey{}))
+		_, hasDeadline := ctx.Deadline()
+		require.False(t, hasDeadline)
+	}
+	require.Equal(t, 1, calls)
+}
@@ -2,35 +2,111 @@ package authkratostokens
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
 	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/orzkratos/authkratos"
 	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/metrics"
+	"github.com/orzkratos/authkratos/internal/structlog"
 	"github.com/orzkratos/authkratos/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yyle88/must"
 	"go.elastic.co/apm/v2"
 )
 
 type Config struct {
-	field      string
-	selectPath *authkratosroutes.SelectPath
-	tokens     map[string]string
-	enable     bool
+	fields            []string
+	selectPath        authkratosroutes.Matcher
+	tokens            map[string]string
+	enable            bool
+	errorMessage      func(reason string) string
+	groups            map[string][]string
+	expiries          map[string]time.Time
+	prefixes          []string
+	tokenSource       TokenSource
+	refreshInterval   time.Duration
+	refreshOnce       sync.Once
+	refreshRef        *atomic.Pointer[authTokenMapBox]
+	closeOnce         sync.Once
+	closing           chan struct{}
+	timingSafe        bool
+	gracePeriod       time.Duration
+	graceMutex        sync.RWMutex
+	graceTokens       map[string]GraceEntry
+	metrics           *metrics.Metrics
+	onAuthSuccess     func(ctx context.Context, username string, operation string)
+	onAuthFailure     func(ctx context.Context, operation string, err *errors.Error)
+	onExpiry          func(ctx context.Context, username string)
+	expiryCooldown    time.Duration
+	expiryMutex       sync.Mutex
+	expiryFiredAt     map[string]time.Time //用户名 -> 上次 onExpiry 回调的时间
+	queryParam        string
+	structuredLogging bool
+	strictToken       bool
 }
 
-func NewConfig(field string, tokens map[string]string, selectPath *authkratosroutes.SelectPath) *Config {
+// 认证失败的原因，作为 WithCustomErrorMessage 回调的参数，便于调用方把错误信息翻译成本地语言
+const (
+	ReasonMissing   = "missing"   //请求里没有携带 token
+	ReasonMismatch  = "mismatch"  //token 不正确
+	ReasonExpired   = "expired"   //token 已过期
+	ReasonMalformed = "malformed" //token 里有控制字符，只在 WithStrictTokenValidation 时出现
+)
+
+func NewConfig(field string, tokens map[string]string, selectPath authkratosroutes.Matcher) *Config {
 	return &Config{
-		field:      field,
-		selectPath: selectPath,
-		tokens:     tokens,
-		enable:     true,
+		fields:         []string{field},
+		selectPath:     selectPath,
+		tokens:         tokens,
+		enable:         true,
+		expiryCooldown: time.Minute,
+	}
+}
+
+// TokenEntry 带过期时间的密码，ExpiresAt 是零值时表示永不过期
+type TokenEntry struct {
+	Password  string
+	ExpiresAt time.Time
+}
+
+// CreateTokenEntry 创建从现在起 ttl 时长后过期的密码
+func CreateTokenEntry(password string, ttl time.Duration) TokenEntry {
+	return TokenEntry{
+		Password:  password,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+// NewConfigWithExpiry 和 NewConfig 相同，但是每个用户的密码可以单独设置过期时间，过期后请求返回 TOKEN_EXPIRED 错误
+func NewConfigWithExpiry(field string, entries map[string]TokenEntry, selectPath authkratosroutes.Matcher) *Config {
+	var tokens = make(map[string]string, len(entries))
+	var expiries = make(map[string]time.Time, len(entries))
+	for username, entry := range entries {
+		tokens[username] = entry.Password
+		if !entry.ExpiresAt.IsZero() {
+			expiries[username] = entry.ExpiresAt
+		}
 	}
+	cfg := NewConfig(field, tokens, selectPath)
+	cfg.expiries = expiries
+	return cfg
 }
 
 func (a *Config) SetEnable(enable bool) {
@@ -39,14 +115,153 @@ func (a *Config) SetEnable(enable bool) {
 
 func (a *Config) IsEnable() bool {
 	if a != nil {
-		return a.enable && a.field != ""
+		return a.enable && a.hasField()
 	}
 	return false
 }
 
+// WithStructuredLogging 按请求打印 token 校验结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithCustomErrorMessage 自定义认证失败时返回的错误信息，参数 reason 是 ReasonMissing 等常量，返回值作为错误的 message
+func (a *Config) WithCustomErrorMessage(fn func(reason string) string) *Config {
+	a.errorMessage = fn
+	return a
+}
+
+// WithGroupMembership 设置用户所属的组，key 是用户名，认证通过后把组列表设置到上下文里，handler 里用 GetGroups 获取
+// 不在 map 里的用户得到空列表
+func (a *Config) WithGroupMembership(groups map[string][]string) *Config {
+	a.groups = groups
+	return a
+}
+
+// WithCustomPrefix 增加自定义的 token 前缀，比如 "Token" 或 "ApiKey"，请求头是 "Token xxx" 时也能通过认证
+// 前缀不区分大小写，可以多次调用累加
+func (a *Config) WithCustomPrefix(prefix string) *Config {
+	prefix = strings.TrimSpace(prefix)
+	must.Nice(prefix)
+	a.prefixes = append(a.prefixes, prefix)
+	return a
+}
+
+// WithStrictTokenValidation 设置为 true 时 token 里有 ASCII 控制字符（比如 \x00）的请求直接返回 401 MALFORMED_TOKEN，不再查表
+// 这种 token 通常是格式错误或者恶意的请求，默认关闭以兼容老的行为
+func (a *Config) WithStrictTokenValidation(strict bool) *Config {
+	a.strictToken = strict
+	return a
+}
+
+// WithTimingSafeMode 使用常量时间比较 token，避免通过响应时间猜测 token，默认关闭
+// 开启后每次请求都和全部 token 的 HMAC 逐个比较，token 很多时会更慢
+func (a *Config) WithTimingSafeMode() *Config {
+	a.timingSafe = true
+	return a
+}
+
+// WithMetrics 统计认证结果到 authkratos_auth_requests_total{operation,result} 指标，第一次请求时才注册
+func (a *Config) WithMetrics(reg prometheus.Registerer) *Config {
+	a.metrics = metrics.New(reg)
+	return a
+}
+
+func (a *Config) newUnauthorized(reason string, message string) *errors.Error {
+	return errors.Unauthorized("UNAUTHORIZED", a.customMessage(reason, message))
+}
+
+func (a *Config) customMessage(reason string, message string) string {
+	if a.errorMessage != nil {
+		return a.errorMessage(reason)
+	}
+	return message
+}
+
+// isExpired 判断用户的密码是否已过期，没有设置过期时间的用户永不过期
+func (a *Config) isExpired(username string) bool {
+	expiresAt, ok := a.expiries[username]
+	return ok && time.Now().After(expiresAt)
+}
+
+// GetField 返回第一个请求头的名称，兼容只设置一个请求头的老代码
 func (a *Config) GetField() string {
+	if a != nil && len(a.fields) > 0 {
+		return a.fields[0]
+	}
+	return ""
+}
+
+// GetFieldNames 返回取 token 的请求头名称列表
+func (a *Config) GetFieldNames() []string {
 	if a != nil {
-		return a.field
+		return a.fields
+	}
+	return nil
+}
+
+// GetEnabledTokenTypes 返回能通过认证的 token 格式，simple/bearer/base64 总是支持，设置了 WithCustomPrefix 时还有 custom
+// 主要用于打印日志
+func (a *Config) GetEnabledTokenTypes() []string {
+	if a == nil {
+		return nil
+	}
+	var tokenTypes = []string{TokenTypeSimple, TokenTypeBearer, TokenTypeBase64}
+	if len(a.prefixes) > 0 {
+		tokenTypes = append(tokenTypes, TokenTypeCustom)
+	}
+	return tokenTypes
+}
+
+// WithFieldName 设置取 token 的请求头名称，会覆盖之前设置的全部请求头
+func (a *Config) WithFieldName(name string) *Config {
+	return a.WithFieldNames(name)
+}
+
+// WithFieldNames 设置多个取 token 的请求头名称，按顺序尝试，使用第一个不为空的值
+func (a *Config) WithFieldNames(names ...string) *Config {
+	a.fields = names
+	return a
+}
+
+func (a *Config) hasField() bool {
+	for _, name := range a.fields {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Config) getHeaderToken(header transport.Header) string {
+	for _, name := range a.fields {
+		if name == "" {
+			continue
+		}
+		if token := header.Get(name); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// WithQueryParamName 请求头里没有 token 时再从 url 的查询参数里取，比如 ?token=xxx，适合 WebSocket 这种不能设置请求头的客户端
+// 仅对 http 请求生效，grpc 请求没有查询参数，注意 url 容易出现在访问日志里，因此只在必要的接口使用
+func (a *Config) WithQueryParamName(name string) *Config {
+	a.queryParam = name
+	return a
+}
+
+// getToken 先从请求头里取 token，没有时再从查询参数里取
+func (a *Config) getToken(tp transport.Transporter) string {
+	if token := a.getHeaderToken(tp.RequestHeader()); token != "" {
+		return token
+	}
+	if a.queryParam != "" {
+		if htp, ok := tp.(http.Transporter); ok && htp.Request() != nil {
+			return htp.Request().URL.Query().Get(a.queryParam)
+		}
 	}
 	return ""
 }
@@ -87,18 +302,83 @@ func (a *Config) GetMapTokens() map[string]string {
 	}
 }
 
+// Equals 比较两个配置是否相同，用于检查线上配置和期望配置是否有偏差
+// 比较 fields、enable、tokens、selectPath、groups、过期时间、自定义前缀、严格校验开关、查询参数名、常量时间比较开关、宽限中的旧密码和过期回调的冷却时长，其中密码使用常量时间比较，回调函数无法比较因此忽略
+func (a *Config) Equals(other *Config) bool {
+	if a == nil || other == nil || a == other {
+		return a == other
+	}
+	if !slices.Equal(a.fields, other.fields) || a.enable != other.enable {
+		return false
+	}
+	if len(a.tokens) != len(other.tokens) {
+		return false
+	}
+	var same = 1
+	for username, password := range a.tokens {
+		otherPassword, ok := other.tokens[username]
+		if !ok {
+			return false
+		}
+		same &= subtle.ConstantTimeCompare([]byte(password), []byte(otherPassword))
+	}
+	if same != 1 {
+		return false
+	}
+	if !equalsSelectPath(a.selectPath, other.selectPath) {
+		return false
+	}
+	if len(a.groups) != len(other.groups) || (a.groups == nil) != (other.groups == nil) {
+		return false
+	}
+	for username, groups := range a.groups {
+		otherGroups, ok := other.groups[username]
+		if !ok || !slices.Equal(groups, otherGroups) {
+			return false
+		}
+	}
+	if !slices.Equal(a.prefixes, other.prefixes) || a.strictToken != other.strictToken || a.queryParam != other.queryParam || a.timingSafe != other.timingSafe {
+		return false
+	}
+	if len(a.expiries) != len(other.expiries) {
+		return false
+	}
+	for username, expiresAt := range a.expiries {
+		otherExpiresAt, ok := other.expiries[username]
+		if !ok || !expiresAt.Equal(otherExpiresAt) {
+			return false
+		}
+	}
+	if a.gracePeriod != other.gracePeriod || a.expiryCooldown != other.expiryCooldown {
+		return false
+	}
+	return equalsGraceTokens(a.copyGraceTokens(), other.copyGraceTokens())
+}
+
+// equalsSelectPath 两个都是 SelectPath 时比较 side 和 operation 集合，否则只有是同一个 Matcher 时才相等
+func equalsSelectPath(a, b authkratosroutes.Matcher) bool {
+	pathA, okA := a.(*authkratosroutes.SelectPath)
+	pathB, okB := b.(*authkratosroutes.SelectPath)
+	if !okA || !okB || pathA == nil || pathB == nil {
+		return a == b
+	}
+	return pathA.Equal(pathB)
+}
+
 func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 	LOG.Infof(
-		"new check_auth middleware enable=%v field=%v tokens=%v include=%v operations=%v",
+		"new check_auth middleware enable=%v field=%v tokens=%v token_types=%v include=%v operations=%v version=%v",
 		cfg.IsEnable(),
-		cfg.field,
+		cfg.fields,
 		len(cfg.tokens),
-		cfg.selectPath.SelectSide,
-		len(cfg.selectPath.Operations),
+		strings.Join(cfg.GetEnabledTokenTypes(), ","),
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
 	)
 
-	return selector.Server(middlewareFunc(cfg, LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+	return selector.Server(structlog.Wrap("check_auth", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
 }
 
 func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
@@ -110,9 +390,9 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 		}
 		match := cfg.selectPath.Match(operation)
 		if match {
-			LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, cfg.selectPath.SelectSide, match)
+			LOG.Debugf("operation=%s include=%v match=%v must check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
 		} else {
-			LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, cfg.selectPath.SelectSide, match)
+			LOG.Debugf("operation=%s include=%v match=%v skip check auth", operation, authkratosroutes.SideOf(cfg.selectPath), match)
 		}
 		return match
 	}
@@ -121,18 +401,7 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 
-	var mapToken = make(map[string]string, len(cfg.tokens))
-	for acc, pwd := range cfg.tokens {
-		mapToken[pwd] = acc
-	}
-	var mapBasic = map[string]string{}
-	for username, token := range cfg.tokens {
-		for _, name := range []string{"None", username} { //有些请求没有用户名因此补个None，兼容老的业务
-			s := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", name, token)))
-			v := "Basic " + string(s)
-			mapBasic[v] = username
-		}
-	}
+	var mapBoxRef = cfg.newMapBoxRef(LOG)
 	return func(handleFunc middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
 			if !cfg.IsEnable() {
@@ -144,32 +413,34 @@ func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 				sp := apmTx.StartSpan("check_auth", "auth", nil)
 				defer sp.End()
 
-				var token = tp.RequestHeader().Get(cfg.field)
+				var token = cfg.getToken(tp)
 				if token == "" {
-					return nil, errors.Unauthorized("UNAUTHORIZED", "check_auth: auth token is missing")
+					erk := cfg.newUnauthorized(ReasonMissing, "check_auth: auth token is missing")
+					cfg.afterAuthFailure(ctx, tp.Operation(), erk, LOG)
+					return nil, erk
 				}
-				if username, ok := mapToken[token]; ok {
-					LOG.Infof("check_auth: rawToken request username:%v quick pass", username)
-				} else if username, ok := mapBasic[token]; ok {
-					LOG.Infof("check_auth: BasicToken request username:%v quick pass", username)
-				} else {
-					var canPass = false
-					if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 {
-						messType := messParts[0]
-						switch {
-						case strings.EqualFold(messType, "Bearer"):
-							//暂不需要
-						case strings.EqualFold(messType, "Basic"):
-							if erk := checkBasicToken(messParts[1], mapToken, LOG); erk != nil {
-								return nil, erk
-							}
-							canPass = true
-						}
+				if cfg.strictToken && hasControlChar(token) {
+					LOG.Warnf("check_auth: auth token has control characters length=%d", len(token))
+					erk := errors.Unauthorized("MALFORMED_TOKEN", cfg.customMessage(ReasonMalformed, "check_auth: auth token is malformed"))
+					cfg.afterAuthFailure(ctx, tp.Operation(), erk, LOG)
+					return nil, erk
+				}
+				authCtx, erk := checkAuthToken(ctx, cfg, token, mapBoxRef.Load(), LOG)
+				if erk != nil {
+					//只有 token 不正确时才尝试宽限中的旧密码，过期的用户不能用旧密码绕过
+					var graceCtx context.Context
+					var ok = false
+					if erk.Reason != "TOKEN_EXPIRED" {
+						graceCtx, ok = checkGraceToken(ctx, cfg, token, LOG)
 					}
-					if !canPass {
-						return nil, errors.Unauthorized("UNAUTHORIZED", "check_auth: auth token is wrong")
+					if !ok {
+						cfg.afterAuthFailure(ctx, tp.Operation(), erk, LOG)
+						return nil, erk
 					}
+					authCtx = graceCtx
 				}
+				cfg.afterAuthSuccess(authCtx, tp.Operation(), LOG)
+				ctx = authCtx
 				return handleFunc(ctx, req)
 			}
 			return nil, errors.Unauthorized("UNAUTHORIZED", "check_auth: wrong context for middleware")
@@ -177,17 +448,219 @@ func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	}
 }
 
-func checkBasicToken(messBasic string, mapToken map[string]string, LOG *log.Helper) *errors.Error {
+// hasControlChar 判断是否有 ASCII 控制字符，即 0x00-0x1f 和 0x7f
+func hasControlChar(token string) bool {
+	for idx := 0; idx < len(token); idx++ {
+		if c := token[idx]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// authTokenMapBox 启动时预先算好各种格式的 token 到用户名的映射，请求时直接查表
+type authTokenMapBox struct {
+	mapToken  map[string]string //token 原文 -> 用户名
+	mapBasic  map[string]string //"Basic " + base64(username:token) -> 用户名
+	mapBearer map[string]string //"Bearer " + token -> 用户名
+	mapCustom []*customPrefixMap
+	macKey    []byte            //WithTimingSafeMode 时非空，是随机生成的 HMAC 密钥
+	macTokens map[string][]byte //WithTimingSafeMode 时非空，上面各个映射的 key -> HMAC
+	passwords map[string]string //用户名 -> token 原文，认证通过时设置到上下文里
+}
+
+// customPrefixMap 是自定义前缀的映射，prefix + " " + token -> 用户名
+type customPrefixMap struct {
+	prefix   string
+	mapToken map[string]string
+}
+
+func newAuthTokenMapBox(tokens map[string]string, prefixes []string, timingSafe bool) *authTokenMapBox {
+	var mapToken = make(map[string]string, len(tokens))
+	for acc, pwd := range tokens {
+		mapToken[pwd] = acc
+	}
+	var mapBasic = map[string]string{}
+	for username, token := range tokens {
+		for _, name := range []string{"None", username} { //有些请求没有用户名因此补个None，兼容老的业务
+			s := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", name, token)))
+			v := "Basic " + string(s)
+			mapBasic[v] = username
+		}
+	}
+	var mapCustom = make([]*customPrefixMap, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		mapCustom = append(mapCustom, &customPrefixMap{
+			prefix:   prefix,
+			mapToken: buildCustomPrefixTokenToUsername(tokens, prefix),
+		})
+	}
+	mapBox := &authTokenMapBox{
+		mapToken:  mapToken,
+		mapBasic:  mapBasic,
+		mapBearer: buildBearerTokenToUsername(tokens),
+		mapCustom: mapCustom,
+		passwords: maps.Clone(tokens),
+	}
+	if timingSafe {
+		mapBox.macKey = make([]byte, sha256.Size)
+		must.Equals(must.V1(rand.Read(mapBox.macKey)), sha256.Size)
+		mapBox.macTokens = map[string][]byte{}
+		for _, mp := range mapBox.allMaps() {
+			for token := range mp {
+				mapBox.macTokens[token] = mapBox.computeMac(token)
+			}
+		}
+	}
+	return mapBox
+}
+
+func (b *authTokenMapBox) allMaps() []map[string]string {
+	var res = []map[string]string{b.mapToken, b.mapBasic, b.mapBearer}
+	for _, custom := range b.mapCustom {
+		res = append(res, custom.mapToken)
+	}
+	return res
+}
+
+func (b *authTokenMapBox) computeMac(token string) []byte {
+	mac := hmac.New(sha256.New, b.macKey)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
+
+// lookup 在映射里查找 token 对应的用户名，WithTimingSafeMode 时和映射里的全部 token 做常量时间比较，不提前返回
+func (b *authTokenMapBox) lookup(mp map[string]string, token string) (string, bool) {
+	if b.macKey == nil {
+		username, ok := mp[token]
+		return username, ok
+	}
+	tokenMac := b.computeMac(token)
+	var username string
+	var found = 0
+	for candidate, name := range mp {
+		if subtle.ConstantTimeCompare(b.macTokens[candidate], tokenMac) == 1 {
+			username = name
+			found = 1
+		}
+	}
+	return username, found == 1
+}
+
+func buildBearerTokenToUsername(tokens map[string]string) map[string]string {
+	return buildCustomPrefixTokenToUsername(tokens, "Bearer")
+}
+
+func buildCustomPrefixTokenToUsername(authTokens map[string]string, prefix string) map[string]string {
+	var res = make(map[string]string, len(authTokens))
+	for username, token := range authTokens {
+		res[prefix+" "+token] = username
+	}
+	return res
+}
+
+// normalizeBearer 把 "bearer xxx" 和 "BEARER xxx" 等写法统一成 "Bearer xxx"，只改前缀不改 token 本身
+// 已经是标准写法时直接返回原字符串，不会额外分配内存
+func normalizeBearer(token string) string {
+	return normalizePrefix(token, "Bearer")
+}
+
+// normalizePrefix 把 token 的前缀统一成 prefix 的写法，前缀不匹配时原样返回
+func normalizePrefix(token string, prefix string) string {
+	if len(token) <= len(prefix) || token[len(prefix)] != ' ' {
+		return token
+	}
+	if token[:len(prefix)] == prefix || !strings.EqualFold(token[:len(prefix)], prefix) {
+		return token
+	}
+	return prefix + token[len(prefix):]
+}
+
+// checkAuthToken 校验 token，通过时把用户名和 token 的格式设置到上下文里，供后面的 handler 使用
+func checkAuthToken(ctx context.Context, cfg *Config, token string, mapBox *authTokenMapBox, LOG *log.Helper) (context.Context, *errors.Error) {
+	var username string
+	var tokenType string
+	if name, ok := mapBox.lookup(mapBox.mapToken, token); ok {
+		LOG.Infof("check_auth: rawToken request username:%v quick pass", name)
+		username, tokenType = name, TokenTypeSimple
+	} else if name, ok := mapBox.lookup(mapBox.mapBasic, token); ok {
+		LOG.Infof("check_auth: BasicToken request username:%v quick pass", name)
+		username, tokenType = name, TokenTypeBase64
+	} else {
+		var canPass = false
+		if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 {
+			messType := messParts[0]
+			switch {
+			case strings.EqualFold(messType, "Bearer"):
+				name, ok := mapBox.lookup(mapBox.mapBearer, normalizeBearer(token))
+				if !ok {
+					return nil, cfg.newUnauthorized(ReasonMismatch, "check_auth: auth token is wrong")
+				}
+				LOG.Infof("check_auth: bearer token request username:%v pass", name)
+				username, tokenType = name, TokenTypeBearer
+				canPass = true
+			case strings.EqualFold(messType, "Basic"):
+				name, erk := checkBasicToken(cfg, messParts[1], mapBox, LOG)
+				if erk != nil {
+					return nil, erk
+				}
+				username, tokenType = name, TokenTypeBase64
+				canPass = true
+			default:
+				for _, custom := range mapBox.mapCustom {
+					if strings.EqualFold(messType, custom.prefix) {
+						name, ok := mapBox.lookup(custom.mapToken, normalizePrefix(token, custom.prefix))
+						if !ok {
+							return nil, cfg.newUnauthorized(ReasonMismatch, "check_auth: auth token is wrong")
+						}
+						LOG.Infof("check_auth: %s token request username:%v pass", custom.prefix, name)
+						username, tokenType = name, TokenTypeCustom
+						canPass = true
+						break
+					}
+				}
+			}
+		}
+		if !canPass {
+			return nil, cfg.newUnauthorized(ReasonMismatch, "check_auth: auth token is wrong")
+		}
+	}
+	if cfg.isExpired(username) {
+		LOG.Infof("check_auth: token request username:%v expired", username)
+		cfg.afterTokenExpired(ctx, username, LOG)
+		return nil, errors.Unauthorized("TOKEN_EXPIRED", cfg.customMessage(ReasonExpired, "check_auth: auth token is expired"))
+	}
+	ctx = setAuthIntoContext(ctx, cfg, username, tokenType)
+	return SetPasswordIntoContext(ctx, mapBox.passwords[username]), nil
+}
+
+func setAuthIntoContext(ctx context.Context, cfg *Config, username string, tokenType string) context.Context {
+	ctx = SetUsernameIntoContext(ctx, username)
+	ctx = SetTokenTypeIntoContext(ctx, tokenType)
+	if cfg.groups != nil {
+		groups, ok := cfg.groups[username]
+		if !ok {
+			groups = []string{}
+		}
+		ctx = SetGroupsIntoContext(ctx, groups)
+	}
+	return ctx
+}
+
+func checkBasicToken(cfg *Config, messBasic string, mapBox *authTokenMapBox, LOG *log.Helper) (string, *errors.Error) {
 	data, err := base64.StdEncoding.DecodeString(messBasic)
 	if err != nil {
-		return errors.Unauthorized("UNAUTHORIZED", "check_auth: error:"+err.Error())
+		return "", cfg.newUnauthorized(ReasonMismatch, "check_auth: error:"+err.Error())
 	}
-	rawParts := strings.Split(string(data), ":")
-	rawToken := rawParts[1] //前面不报错的话这边必然就能切出元素，其下标不会超出限制
-	username, ok := mapToken[rawToken]
+	rawParts := strings.SplitN(string(data), ":", 2)
+	if len(rawParts) != 2 {
+		return "", cfg.newUnauthorized(ReasonMismatch, "check_auth: auth token is wrong")
+	}
+	rawToken := rawParts[1]
+	username, ok := mapBox.lookup(mapBox.mapToken, rawToken)
 	if !ok {
-		return errors.Unauthorized("UNAUTHORIZED", "check_auth: auth token is wrong")
+		return "", cfg.newUnauthorized(ReasonMismatch, "check_auth: auth token is wrong")
 	}
 	LOG.Infof("check_auth: basic token request username:%v pass", username)
-	return nil
+	return username, nil
 }
@@ -1,9 +1,469 @@
 package authkratostokens
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/orzkratos/authkratos/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
 	m.Run()
 }
+
+func newTestConfig() *Config {
+	return NewConfig("Authorization", map[string]string{
+		"alice": "alice-token",
+		"bob":   "bob-token",
+	}, authkratosroutes.NewInclude("/a"))
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return ctx, nil
+}
+
+// callWithToken 模拟带 token 的请求，返回 handler 收到的上下文
+func callWithToken(mw middleware.Middleware, operation string, token string) (context.Context, *errors.Error) {
+	tp := kratosmock.NewHTTPTransport(operation)
+	if token != "" {
+		tp.WithHeader("Authorization", token)
+	}
+	res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		return nil, errors.FromError(err)
+	}
+	return res.(context.Context), nil
+}
+
+func TestNewMiddleware(t *testing.T) {
+	mw := NewMiddleware(newTestConfig(), log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", utils.BasicAuth("bob", "bob-token"))
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", utils.BasicAuth("None", "bob-token"))
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/b", "")
+	require.Nil(t, erk)
+}
+
+func TestConfig_WithCustomErrorMessage(t *testing.T) {
+	var reasons []string
+	cfg := newTestConfig().WithCustomErrorMessage(func(reason string) string {
+		reasons = append(reasons, reason)
+		return "认证失败:" + reason
+	})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	testCases := []struct {
+		token  string
+		reason string
+	}{
+		{token: "", reason: ReasonMissing},
+		{token: "wrong-token", reason: ReasonMismatch},
+		{token: utils.BasicAuth("alice", "wrong-token"), reason: ReasonMismatch},
+		{token: "Basic !!!", reason: ReasonMismatch},
+		{token: "Basic " + utils.BasicEncode("alice", "")[:4], reason: ReasonMismatch},
+	}
+	for _, tc := range testCases {
+		reasons = nil
+		_, erk := callWithToken(mw, "/a", tc.token)
+		require.True(t, errors.IsUnauthorized(erk), tc.token)
+		require.Equal(t, []string{tc.reason}, reasons, tc.token)
+		require.Equal(t, "认证失败:"+tc.reason, erk.Message, tc.token)
+	}
+}
+
+func TestConfig_Equals(t *testing.T) {
+	require.True(t, newTestConfig().Equals(newTestConfig()))
+
+	var none *Config
+	require.True(t, none.Equals(nil))
+	require.False(t, none.Equals(newTestConfig()))
+	require.False(t, newTestConfig().Equals(nil))
+
+	withGroups := func() *Config {
+		return newTestConfig().WithGroupMembership(map[string][]string{"alice": {"admin", "dev"}})
+	}
+	require.True(t, withGroups().Equals(withGroups()))
+
+	newDifferences := []func() *Config{
+		func() *Config {
+			return NewConfig("X-Api-Key", newTestConfig().GetAuths(), authkratosroutes.NewInclude("/a"))
+		},
+		func() *Config {
+			cfg := newTestConfig()
+			cfg.SetEnable(false)
+			return cfg
+		},
+		func() *Config {
+			return NewConfig("Authorization", map[string]string{"alice": "alice-token"}, authkratosroutes.NewInclude("/a"))
+		},
+		func() *Config {
+			return NewConfig("Authorization", map[string]string{"alice": "alice-token", "bob": "wrong"}, authkratosroutes.NewInclude("/a"))
+		},
+		func() *Config {
+			return NewConfig("Authorization", map[string]string{"alice": "alice-token", "carl": "bob-token"}, authkratosroutes.NewInclude("/a"))
+		},
+		func() *Config {
+			return NewConfig("Authorization", newTestConfig().GetAuths(), authkratosroutes.NewExclude("/a"))
+		},
+		func() *Config {
+			return NewConfig("Authorization", newTestConfig().GetAuths(), authkratosroutes.NewInclude("/a", "/b"))
+		},
+		func() *Config {
+			return newTestConfig().WithGroupMembership(map[string][]string{"alice": {"admin"}})
+		},
+		withGroups,
+		func() *Config {
+			return newTestConfig().WithStrictTokenValidation(true)
+		},
+		func() *Config {
+			return newTestConfig().WithQueryParamName("token")
+		},
+		func() *Config {
+			return newTestConfig().WithTimingSafeMode()
+		},
+		func() *Config {
+			return newTestConfig().WithExpiryCooldown(time.Hour)
+		},
+	}
+	for idx, newDifference := range newDifferences {
+		require.False(t, newTestConfig().Equals(newDifference()), idx)
+		require.False(t, newDifference().Equals(newTestConfig()), idx)
+	}
+}
+
+func TestNewConfigWithExpiry(t *testing.T) {
+	cfg := NewConfigWithExpiry("Authorization", map[string]TokenEntry{
+		"alice": CreateTokenEntry("alice-token", 100*time.Millisecond),
+		"bob":   {Password: "bob-token"},
+	}, authkratosroutes.NewInclude("/a"))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", utils.BasicAuth("alice", "alice-token"))
+	require.Nil(t, erk)
+
+	time.Sleep(150 * time.Millisecond)
+
+	_, erk = callWithToken(mw, "/a", "alice-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+	_, erk = callWithToken(mw, "/a", utils.BasicAuth("alice", "alice-token"))
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+
+	//零值的过期时间表示永不过期
+	ctx, erk := callWithToken(mw, "/a", "bob-token")
+	require.Nil(t, erk)
+	username, ok := GetUsername(ctx)
+	require.True(t, ok)
+	require.Equal(t, "bob", username)
+}
+
+func TestConfig_WithFieldNames(t *testing.T) {
+	cfg := newTestConfig().WithFieldNames("Authorization", "X-Api-Key")
+	require.Equal(t, "Authorization", cfg.GetField())
+	require.Equal(t, []string{"Authorization", "X-Api-Key"}, cfg.GetFieldNames())
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for _, key := range []string{"Authorization", "X-Api-Key"} {
+		tp := kratosmock.NewHTTPTransport("/a").WithHeader(key, "alice-token")
+		_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+		require.NoError(t, err, key)
+	}
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Other", "alice-token")
+	_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	require.True(t, errors.IsUnauthorized(err))
+
+	require.False(t, newTestConfig().Equals(newTestConfig().WithFieldNames("Authorization", "X-Api-Key")))
+	require.True(t, newTestConfig().Equals(newTestConfig().WithFieldName("Authorization")))
+}
+
+func TestNewMiddleware_Bearer(t *testing.T) {
+	mw := NewMiddleware(newTestConfig(), log.DefaultLogger)
+
+	for _, token := range []string{"Bearer alice-token", "bearer alice-token", "BEARER alice-token", "bEaReR alice-token"} {
+		ctx, erk := callWithToken(mw, "/a", token)
+		require.Nil(t, erk, token)
+		username, _ := GetUsername(ctx)
+		require.Equal(t, "alice", username, token)
+		tokenType, _ := GetTokenType(ctx)
+		require.Equal(t, TokenTypeBearer, tokenType, token)
+	}
+
+	for _, token := range []string{"Bearer ALICE-TOKEN", "bearer wrong-token", "Bearer  alice-token", "Bearer"} {
+		_, erk := callWithToken(mw, "/a", token)
+		require.True(t, errors.IsUnauthorized(erk), token)
+	}
+}
+
+func TestNormalizeBearer(t *testing.T) {
+	require.Equal(t, "Bearer abc", normalizeBearer("Bearer abc"))
+	require.Equal(t, "Bearer abc", normalizeBearer("bearer abc"))
+	require.Equal(t, "Bearer abc", normalizeBearer("BEARER abc"))
+	require.Equal(t, "Bearer ABC", normalizeBearer("beARer ABC"))
+	require.Equal(t, "Basic abc", normalizeBearer("Basic abc"))
+	require.Equal(t, "bearer", normalizeBearer("bearer"))
+
+	token := "Bearer abc"
+	require.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		token = normalizeBearer(token)
+	}))
+}
+
+func TestConfig_GetEnabledTokenTypes(t *testing.T) {
+	require.Equal(t, []string{TokenTypeSimple, TokenTypeBearer, TokenTypeBase64}, newTestConfig().GetEnabledTokenTypes())
+	require.Equal(t, []string{TokenTypeSimple, TokenTypeBearer, TokenTypeBase64, TokenTypeCustom}, newTestConfig().WithCustomPrefix("Token").GetEnabledTokenTypes())
+
+	mw := NewMiddleware(newTestConfig(), log.DefaultLogger)
+	for _, token := range []string{"alice-token", "Bearer alice-token", utils.BasicAuth("alice", "alice-token")} {
+		_, erk := callWithToken(mw, "/a", token)
+		require.Nil(t, erk, token)
+	}
+}
+
+func TestConfig_WithCustomPrefix(t *testing.T) {
+	cfg := newTestConfig().WithCustomPrefix("Token ").WithCustomPrefix("ApiKey")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	testCases := []struct {
+		token    string
+		username string
+	}{
+		{token: "Token alice-token", username: "alice"},
+		{token: "token bob-token", username: "bob"},
+		{token: "APIKEY alice-token", username: "alice"},
+		{token: "ApiKey bob-token", username: "bob"},
+		{token: "Bearer bob-token", username: "bob"},
+	}
+	for _, tc := range testCases {
+		ctx, erk := callWithToken(mw, "/a", tc.token)
+		require.Nil(t, erk, tc.token)
+		username, _ := GetUsername(ctx)
+		require.Equal(t, tc.username, username, tc.token)
+	}
+
+	for _, token := range []string{"Token wrong-token", "Kratos alice-token"} {
+		_, erk := callWithToken(mw, "/a", token)
+		require.True(t, errors.IsUnauthorized(erk), token)
+	}
+
+	ctx, erk := callWithToken(mw, "/a", "Token alice-token")
+	require.Nil(t, erk)
+	tokenType, _ := GetTokenType(ctx)
+	require.Equal(t, TokenTypeCustom, tokenType)
+}
+
+func TestNewMiddleware_DynamicSelectPath(t *testing.T) {
+	dynamic := authkratosroutes.NewDynamic(authkratosroutes.NewInclude("/a"))
+	mw := NewMiddleware(NewConfig("Authorization", map[string]string{"alice": "alice-token"}, dynamic), log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/b", "")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//不重建中间件，更新以后 "/b" 也需要认证
+	dynamic.Update(authkratosroutes.NewInclude("/a", "/b"))
+	_, erk = callWithToken(mw, "/b", "")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/b", "alice-token")
+	require.Nil(t, erk)
+}
+
+func TestNewMiddleware_AllAndNone(t *testing.T) {
+	mw := NewMiddleware(NewConfig("Authorization", map[string]string{"alice": "alice-token"}, authkratosroutes.NewAll()), log.DefaultLogger)
+	for _, operation := range []string{"/a", "/b"} {
+		_, erk := callWithToken(mw, operation, "")
+		require.True(t, errors.IsUnauthorized(erk), operation)
+	}
+
+	mw = NewMiddleware(NewConfig("Authorization", map[string]string{"alice": "alice-token"}, authkratosroutes.NewNone()), log.DefaultLogger)
+	for _, operation := range []string{"/a", "/b"} {
+		_, erk := callWithToken(mw, operation, "")
+		require.Nil(t, erk, operation)
+	}
+}
+
+func TestConfig_WithTimingSafeMode(t *testing.T) {
+	cfg := newTestConfig().WithTimingSafeMode().WithCustomPrefix("Token")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	testCases := []struct {
+		token    string
+		username string
+	}{
+		{token: "alice-token", username: "alice"},
+		{token: utils.BasicAuth("bob", "bob-token"), username: "bob"},
+		{token: "basic " + utils.BasicEncode("other", "alice-token"), username: "alice"},
+		{token: "bearer bob-token", username: "bob"},
+		{token: "Token alice-token", username: "alice"},
+	}
+	for _, tc := range testCases {
+		ctx, erk := callWithToken(mw, "/a", tc.token)
+		require.Nil(t, erk, tc.token)
+		username, _ := GetUsername(ctx)
+		require.Equal(t, tc.username, username, tc.token)
+	}
+	for _, token := range []string{"alice-toke", "alice-token-x", "Bearer alice", utils.BasicAuth("bob", "bob")} {
+		_, erk := callWithToken(mw, "/a", token)
+		require.True(t, errors.IsUnauthorized(erk), token)
+	}
+}
+
+func BenchmarkCheckAuthToken(b *testing.B) {
+	var tokens = make(map[string]string, 100)
+	for idx := 0; idx < 100; idx++ {
+		tokens[utils.NewUUID()] = utils.NewUUID()
+	}
+	username := utils.Sample(utils.Keys(tokens))
+	LOG := log.NewHelper(log.NewFilter(log.DefaultLogger, log.FilterLevel(log.LevelError)))
+
+	for _, timingSafe := range []bool{false, true} {
+		cfg := NewConfig("Authorization", tokens, authkratosroutes.NewInclude("/a"))
+		mapBox := newAuthTokenMapBox(tokens, nil, timingSafe)
+		name := "map"
+		if timingSafe {
+			name = "timing_safe"
+		}
+		b.Run(name, func(b *testing.B) {
+			for idx := 0; idx < b.N; idx++ {
+				if _, erk := checkAuthToken(context.Background(), cfg, tokens[username], mapBox, LOG); erk != nil {
+					b.Fatal(erk)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_WithMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mw := NewMiddleware(newTestConfig().WithMetrics(reg), log.DefaultLogger)
+
+	for idx := 0; idx < 3; idx++ {
+		_, erk := callWithToken(mw, "/a", "alice-token")
+		require.Nil(t, erk)
+	}
+	_, erk := callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/a", "")
+	require.True(t, errors.IsUnauthorized(erk))
+	//不需要认证的接口不计数
+	_, erk = callWithToken(mw, "/b", "")
+	require.Nil(t, erk)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP authkratos_auth_requests_total Total number of requests checked by authkratos middlewares.
+# TYPE authkratos_auth_requests_total counter
+authkratos_auth_requests_total{operation="/a",result="failure"} 2
+authkratos_auth_requests_total{operation="/a",result="success"} 3
+`), "authkratos_auth_requests_total"))
+}
+
+func TestConfig_WithQueryParamName(t *testing.T) {
+	mw := NewMiddleware(newTestConfig().WithQueryParamName("token"), log.DefaultLogger)
+	callWithQuery := func(tp *kratosmock.Transport, query string) (context.Context, *errors.Error) {
+		if tp.Request() != nil {
+			tp.Request().URL.RawQuery = query
+		}
+		res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+		if err != nil {
+			return nil, errors.FromError(err)
+		}
+		return res.(context.Context), nil
+	}
+
+	ctx, erk := callWithQuery(kratosmock.NewHTTPTransport("/a"), "token=alice-token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "alice", username)
+
+	//请求头优先
+	ctx, erk = callWithQuery(kratosmock.NewHTTPTransport("/a").WithHeader("Authorization", "bob-token"), "token=alice-token")
+	require.Nil(t, erk)
+	username, _ = GetUsername(ctx)
+	require.Equal(t, "bob", username)
+
+	_, erk = callWithQuery(kratosmock.NewHTTPTransport("/a"), "token=wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithQuery(kratosmock.NewHTTPTransport("/a"), "other=alice-token")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//grpc 请求没有查询参数
+	_, erk = callWithQuery(kratosmock.NewGRPCTransport("/a"), "")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//没有设置时不从查询参数里取
+	_, erk = callWithToken(NewMiddleware(newTestConfig(), log.DefaultLogger), "/a", "")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+// decisionLogger 记录结构化日志里的 decision 字段
+type decisionLogger struct {
+	decisions []interface{}
+}
+
+func (l *decisionLogger) Log(level log.Level, keyvals ...interface{}) error {
+	for idx := 0; idx+1 < len(keyvals); idx += 2 {
+		if keyvals[idx] == "decision" {
+			l.decisions = append(l.decisions, keyvals[idx+1])
+		}
+	}
+	return nil
+}
+
+func TestConfig_WithStructuredLogging(t *testing.T) {
+	LOGGER := &decisionLogger{}
+	mw := NewMiddleware(newTestConfig().WithStructuredLogging(true), LOGGER)
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/b", "")
+	require.Nil(t, erk)
+	require.Equal(t, []interface{}{"pass", "reject"}, LOGGER.decisions)
+
+	LOGGER = &decisionLogger{}
+	_, erk = callWithToken(NewMiddleware(newTestConfig(), LOGGER), "/a", "alice-token")
+	require.Nil(t, erk)
+	require.Empty(t, LOGGER.decisions)
+}
+
+func TestConfig_WithStrictTokenValidation(t *testing.T) {
+	tokens := map[string]string{"alice": "alice-token", "mallory": "mallory\x00token"}
+
+	//不开启时按原来的逻辑查表
+	mw := NewMiddleware(NewConfig("Authorization", tokens, authkratosroutes.NewAll()), log.DefaultLogger)
+	ctx, erk := callWithToken(mw, "/a", "mallory\x00token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "mallory", username)
+
+	//开启以后即使表里有这个 token 也在查表之前拒绝
+	mw = NewMiddleware(NewConfig("Authorization", tokens, authkratosroutes.NewAll()).WithStrictTokenValidation(true), log.DefaultLogger)
+	for _, token := range []string{"mallory\x00token", "alice-token\x00", "Bearer alice\x1ftoken", "alice-token\x7f"} {
+		_, erk = callWithToken(mw, "/a", token)
+		require.True(t, errors.IsUnauthorized(erk), token)
+		require.Equal(t, "MALFORMED_TOKEN", erk.Reason, token)
+	}
+	_, erk = callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Equal(t, "UNAUTHORIZED", erk.Reason)
+}
@@ -0,0 +1,78 @@
+package authkratostokens
+
+import (
+	"context"
+
+	"github.com/orzkratos/authkratos/authkratosctx"
+)
+
+// 认证通过时使用的 token 格式
+const (
+	TokenTypeSimple = "simple" //直接传 token 原文
+	TokenTypeBase64 = "base64" //Basic 格式，即 "Basic " + base64(username:token)
+	TokenTypeBearer = "bearer" //Bearer 格式，即 "Bearer " + token，前缀不区分大小写
+	TokenTypeCustom = "custom" //WithCustomPrefix 设置的前缀格式，即 prefix + " " + token
+)
+
+// UserInfo 认证通过的用户信息，定义在 authkratosctx 里，这里是别名便于使用
+type UserInfo = authkratosctx.UserInfo
+
+func SetUserInfoIntoContext(ctx context.Context, userInfo UserInfo) context.Context {
+	return authkratosctx.SetUserInfoIntoContext(ctx, userInfo)
+}
+
+// GetUserInfo 在 handler 里获取认证通过的用户信息
+func GetUserInfo(ctx context.Context) (UserInfo, bool) {
+	return authkratosctx.GetUserInfo(ctx)
+}
+
+// SetUsernameIntoContext 认证通过时设置新的用户信息，只有用户名
+// 上下文里已有的用户信息不保留，避免之前的角色和 Metadata 被当成新用户的
+func SetUsernameIntoContext(ctx context.Context, username string) context.Context {
+	return SetUserInfoIntoContext(ctx, UserInfo{Username: username})
+}
+
+// GetUsername 在 handler 里获取认证通过的用户名，用户名为空时返回 false
+func GetUsername(ctx context.Context) (string, bool) {
+	userInfo, ok := GetUserInfo(ctx)
+	if !ok || userInfo.Username == "" {
+		return "", false
+	}
+	return userInfo.Username, true
+}
+
+type passwordKey struct{}
+
+func SetPasswordIntoContext(ctx context.Context, password string) context.Context {
+	return context.WithValue(ctx, passwordKey{}, password)
+}
+
+// GetPassword 在 handler 里获取认证通过的密码，即 token 原文，比如调用下游服务时需要转发 Basic 认证
+func GetPassword(ctx context.Context) (string, bool) {
+	password, ok := ctx.Value(passwordKey{}).(string)
+	return password, ok
+}
+
+type tokenTypeKey struct{}
+
+func SetTokenTypeIntoContext(ctx context.Context, tokenType string) context.Context {
+	return context.WithValue(ctx, tokenTypeKey{}, tokenType)
+}
+
+// GetTokenType 在 handler 里获取认证时使用的 token 格式，是 TokenTypeSimple 等常量
+func GetTokenType(ctx context.Context) (string, bool) {
+	tokenType, ok := ctx.Value(tokenTypeKey{}).(string)
+	return tokenType, ok
+}
+
+type groupsKey struct{}
+
+func SetGroupsIntoContext(ctx context.Context, groups []string) context.Context {
+	return context.WithValue(ctx, groupsKey{}, groups)
+}
+
+// GetGroups 在 handler 里获取用户所属的组，需要配置 WithGroupMembership
+func GetGroups(ctx context.Context) ([]string, bool) {
+	groups, ok := ctx.Value(groupsKey{}).([]string)
+	return groups, ok
+}
@@ -0,0 +1,111 @@
+package authkratostokens
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosctx"
+	"github.com/orzkratos/authkratos/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTokenType(t *testing.T) {
+	mw := NewMiddleware(newTestConfig(), log.DefaultLogger)
+
+	testCases := []struct {
+		token     string
+		tokenType string
+	}{
+		{token: "alice-token", tokenType: TokenTypeSimple},
+		{token: utils.BasicAuth("alice", "alice-token"), tokenType: TokenTypeBase64},
+		{token: "basic " + utils.BasicEncode("other", "alice-token"), tokenType: TokenTypeBase64},
+	}
+	for _, tc := range testCases {
+		ctx, erk := callWithToken(mw, "/a", tc.token)
+		require.Nil(t, erk, tc.token)
+
+		tokenType, ok := GetTokenType(ctx)
+		require.True(t, ok)
+		require.Equal(t, tc.tokenType, tokenType, tc.token)
+
+		username, ok := GetUsername(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice", username)
+
+		password, ok := GetPassword(ctx)
+		require.True(t, ok)
+		require.Equal(t, "alice-token", password)
+	}
+}
+
+func TestGetUsername(t *testing.T) {
+	_, ok := GetUsername(context.Background())
+	require.False(t, ok)
+	_, ok = GetTokenType(context.Background())
+	require.False(t, ok)
+
+	ctx := SetUsernameIntoContext(context.Background(), "bob")
+	username, ok := GetUsername(ctx)
+	require.True(t, ok)
+	require.Equal(t, "bob", username)
+}
+
+func TestGetPassword(t *testing.T) {
+	_, ok := GetPassword(context.Background())
+	require.False(t, ok)
+
+	ctx, erk := callWithToken(NewMiddleware(newTestConfig(), log.DefaultLogger), "/a", "Bearer bob-token")
+	require.Nil(t, erk)
+	password, ok := GetPassword(ctx)
+	require.True(t, ok)
+	require.Equal(t, "bob-token", password)
+}
+
+func TestGetGroups(t *testing.T) {
+	cfg := newTestConfig().WithGroupMembership(map[string][]string{
+		"alice": {"admin", "dev"},
+	})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	groups, ok := GetGroups(ctx)
+	require.True(t, ok)
+	require.Equal(t, []string{"admin", "dev"}, groups)
+
+	ctx, erk = callWithToken(mw, "/a", utils.BasicAuth("bob", "bob-token"))
+	require.Nil(t, erk)
+	groups, ok = GetGroups(ctx)
+	require.True(t, ok)
+	require.Empty(t, groups)
+	require.NotNil(t, groups)
+
+	ctx, erk = callWithToken(NewMiddleware(newTestConfig(), log.DefaultLogger), "/a", "alice-token")
+	require.Nil(t, erk)
+	_, ok = GetGroups(ctx)
+	require.False(t, ok)
+}
+
+func TestGetUserInfo(t *testing.T) {
+	mw := NewMiddleware(newTestConfig(), log.DefaultLogger)
+	ctx, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	userInfo, ok := GetUserInfo(ctx)
+	require.True(t, ok)
+	require.Equal(t, "alice", userInfo.Username)
+
+	//之前的用户信息不能带到新认证的用户上
+	ctx = SetUserInfoIntoContext(context.Background(), UserInfo{Username: "mallory", UserID: "2", Roles: []string{"admin"}, Metadata: map[string]string{"tenant_id": "t1"}})
+	ctx = SetUsernameIntoContext(ctx, "bob")
+	userInfo, ok = authkratosctx.GetUserInfo(ctx)
+	require.True(t, ok)
+	require.Equal(t, UserInfo{Username: "bob"}, userInfo)
+	username, ok := GetUsername(ctx)
+	require.True(t, ok)
+	require.Equal(t, "bob", username)
+
+	//有用户信息但是没有用户名时不算认证通过
+	_, ok = GetUsername(SetUserInfoIntoContext(context.Background(), UserInfo{Roles: []string{"dev"}}))
+	require.False(t, ok)
+}
@@ -0,0 +1,139 @@
+package authkratostokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/yyle88/must"
+)
+
+// GraceEntry 轮换密码时旧密码的宽限信息，在 ExpiresAt 之前旧密码依然能通过认证
+type GraceEntry struct {
+	Username  string
+	ExpiresAt time.Time
+}
+
+// WithGracePeriod 设置旧密码默认的宽限时长，AddGraceToken 不传过期时间时使用
+func (a *Config) WithGracePeriod(d time.Duration) *Config {
+	must.TRUE(d > 0)
+	a.gracePeriod = d
+	return a
+}
+
+// AddGraceToken 轮换密码时把旧密码加入宽限列表，在 expiry 之前旧密码依然能通过认证，并打印警告日志提醒调用方更换
+// expiry 是零值时使用 WithGracePeriod 设置的时长，中间件创建以后也可以调用
+func (a *Config) AddGraceToken(username string, oldToken string, expiry time.Time) *Config {
+	must.Nice(oldToken)
+	if expiry.IsZero() {
+		must.TRUE(a.gracePeriod > 0)
+		expiry = time.Now().Add(a.gracePeriod)
+	}
+
+	a.graceMutex.Lock()
+	defer a.graceMutex.Unlock()
+	if a.graceTokens == nil {
+		a.graceTokens = map[string]GraceEntry{}
+	}
+	a.graceTokens[oldToken] = GraceEntry{Username: username, ExpiresAt: expiry}
+	return a
+}
+
+// lookupGraceToken 查找宽限中的旧密码，WithTimingSafeMode 时和全部旧密码做常量时间比较
+func (a *Config) lookupGraceToken(password string) (GraceEntry, bool) {
+	a.graceMutex.RLock()
+	defer a.graceMutex.RUnlock()
+
+	if !a.timingSafe {
+		entry, ok := a.graceTokens[password]
+		return entry, ok
+	}
+	passwordSum := sha256.Sum256([]byte(password))
+	var res GraceEntry
+	var found = 0
+	for candidate, entry := range a.graceTokens {
+		candidateSum := sha256.Sum256([]byte(candidate))
+		if subtle.ConstantTimeCompare(candidateSum[:], passwordSum[:]) == 1 {
+			res = entry
+			found = 1
+		}
+	}
+	return res, found == 1
+}
+
+// copyGraceTokens 在锁里复制宽限列表，比较两个配置时不用同时持有两个锁
+func (a *Config) copyGraceTokens() map[string]GraceEntry {
+	a.graceMutex.RLock()
+	defer a.graceMutex.RUnlock()
+	return maps.Clone(a.graceTokens)
+}
+
+// equalsGraceTokens 比较两个宽限列表，旧密码是 map 的 key，因此和对方的全部旧密码做常量时间比较，不直接查 map
+func equalsGraceTokens(a, b map[string]GraceEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for token, entry := range a {
+		var same = 0
+		for otherToken, otherEntry := range b {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(otherToken)) == 1 && entry.Username == otherEntry.Username && entry.ExpiresAt.Equal(otherEntry.ExpiresAt) {
+				same = 1
+			}
+		}
+		if same != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkGraceToken 正常的认证因为 token 不正确没通过时检查是否是宽限中的旧密码，支持原文、Basic、Bearer 和自定义前缀的格式
+// 用户的密码已过期时旧密码也不能通过认证
+func checkGraceToken(ctx context.Context, cfg *Config, token string, LOG *log.Helper) (context.Context, bool) {
+	password, tokenType := parseGracePassword(cfg, token)
+	entry, ok := cfg.lookupGraceToken(password)
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		LOG.Infof("check_auth: grace token request username:%v expired", entry.Username)
+		return nil, false
+	}
+	if cfg.isExpired(entry.Username) {
+		LOG.Infof("check_auth: grace token request username:%v token expired", entry.Username)
+		return nil, false
+	}
+	LOG.Warnf("check_auth: grace token request username:%v pass, the token is deprecated and expires at %v", entry.Username, entry.ExpiresAt)
+	ctx = setAuthIntoContext(ctx, cfg, entry.Username, tokenType)
+	return SetPasswordIntoContext(ctx, password), true
+}
+
+func parseGracePassword(cfg *Config, token string) (string, string) {
+	if messParts := strings.SplitN(token, " ", 2); len(messParts) == 2 {
+		messType := messParts[0]
+		switch {
+		case strings.EqualFold(messType, "Bearer"):
+			return messParts[1], TokenTypeBearer
+		case strings.EqualFold(messType, "Basic"):
+			data, err := base64.StdEncoding.DecodeString(messParts[1])
+			if err != nil {
+				return token, TokenTypeSimple
+			}
+			if rawParts := strings.SplitN(string(data), ":", 2); len(rawParts) == 2 {
+				return rawParts[1], TokenTypeBase64
+			}
+		default:
+			for _, prefix := range cfg.prefixes {
+				if strings.EqualFold(messType, prefix) {
+					return messParts[1], TokenTypeCustom
+				}
+			}
+		}
+	}
+	return token, TokenTypeSimple
+}
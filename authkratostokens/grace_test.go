@@ -0,0 +1,114 @@
+package authkratostokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_AddGraceToken(t *testing.T) {
+	for _, timingSafe := range []bool{false, true} {
+		cfg := newTestConfig().AddGraceToken("alice", "alice-old-token", time.Now().Add(100*time.Millisecond))
+		if timingSafe {
+			cfg = cfg.WithTimingSafeMode()
+		}
+		mw := NewMiddleware(cfg, log.DefaultLogger)
+
+		for _, token := range []string{"alice-old-token", "Bearer alice-old-token", utils.BasicAuth("alice", "alice-old-token")} {
+			ctx, erk := callWithToken(mw, "/a", token)
+			require.Nil(t, erk, token)
+			username, _ := GetUsername(ctx)
+			require.Equal(t, "alice", username, token)
+		}
+		_, erk := callWithToken(mw, "/a", "alice-token")
+		require.Nil(t, erk)
+
+		time.Sleep(150 * time.Millisecond)
+
+		_, erk = callWithToken(mw, "/a", "alice-old-token")
+		require.True(t, errors.IsUnauthorized(erk))
+		_, erk = callWithToken(mw, "/a", "alice-token")
+		require.Nil(t, erk)
+	}
+}
+
+func TestConfig_WithGracePeriod(t *testing.T) {
+	cfg := newTestConfig().WithGracePeriod(time.Hour)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/a", "bob-old-token")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//中间件创建以后加入的旧密码也能生效
+	cfg.AddGraceToken("bob", "bob-old-token", time.Time{})
+	ctx, erk := callWithToken(mw, "/a", "bob-old-token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "bob", username)
+
+	require.Panics(t, func() {
+		newTestConfig().AddGraceToken("bob", "bob-old-token", time.Time{})
+	})
+}
+
+func TestConfig_AddGraceToken_Expired(t *testing.T) {
+	cfg := NewConfigWithExpiry("Authorization", map[string]TokenEntry{
+		"alice": {Password: "alice-token", ExpiresAt: time.Now().Add(-time.Second)},
+		"bob":   {Password: "bob-token"},
+	}, authkratosroutes.NewInclude("/a")).
+		AddGraceToken("alice", "alice-old-token", time.Now().Add(time.Hour)).
+		AddGraceToken("bob", "bob-old-token", time.Now().Add(time.Hour))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//密码已过期的用户不能用宽限中的旧密码通过认证
+	_, erk := callWithToken(mw, "/a", "alice-old-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/a", "alice-token")
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+
+	ctx, erk := callWithToken(mw, "/a", "bob-old-token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "bob", username)
+}
+
+func TestConfig_Equals_Grace(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	withGrace := func() *Config {
+		return newTestConfig().WithGracePeriod(time.Hour).AddGraceToken("alice", "alice-old-token", expiry)
+	}
+	cfg := withGrace()
+	require.True(t, cfg.Equals(cfg))
+	require.True(t, withGrace().Equals(withGrace()))
+
+	newDifferences := []func() *Config{
+		newTestConfig,
+		func() *Config {
+			return newTestConfig().WithGracePeriod(time.Hour)
+		},
+		func() *Config {
+			return newTestConfig().WithGracePeriod(time.Minute).AddGraceToken("alice", "alice-old-token", expiry)
+		},
+		func() *Config {
+			return newTestConfig().WithGracePeriod(time.Hour).AddGraceToken("alice", "alice-older-token", expiry)
+		},
+		func() *Config {
+			return newTestConfig().WithGracePeriod(time.Hour).AddGraceToken("bob", "alice-old-token", expiry)
+		},
+		func() *Config {
+			return newTestConfig().WithGracePeriod(time.Hour).AddGraceToken("alice", "alice-old-token", expiry.Add(time.Second))
+		},
+		func() *Config {
+			return withGrace().AddGraceToken("bob", "bob-old-token", expiry)
+		},
+	}
+	for idx, newDifference := range newDifferences {
+		require.False(t, withGrace().Equals(newDifference()), idx)
+		require.False(t, newDifference().Equals(withGrace()), idx)
+	}
+}
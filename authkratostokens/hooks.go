@@ -0,0 +1,85 @@
+package authkratostokens
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/internal/metrics"
+	"github.com/yyle88/must"
+)
+
+// WithOnAuthSuccess 认证通过后、进入 handler 之前回调，回调是同步执行的，耗时的逻辑请在回调里另起协程
+func (a *Config) WithOnAuthSuccess(fn func(ctx context.Context, username string, operation string)) *Config {
+	a.onAuthSuccess = fn
+	return a
+}
+
+// WithOnAuthFailure 认证失败后、返回错误之前回调，回调是同步执行的，耗时的逻辑请在回调里另起协程
+func (a *Config) WithOnAuthFailure(fn func(ctx context.Context, operation string, err *errors.Error)) *Config {
+	a.onAuthFailure = fn
+	return a
+}
+
+// WithOnExpiry 用户的密码过期导致认证失败时回调，比如发消息提醒用户更换密码，回调是同步执行的
+// 同一个用户在 WithExpiryCooldown 设置的时长内只回调一次，避免用过期密码反复请求时回调太多，默认是1分钟
+func (a *Config) WithOnExpiry(fn func(ctx context.Context, username string)) *Config {
+	a.onExpiry = fn
+	return a
+}
+
+// WithExpiryCooldown 设置同一个用户两次 WithOnExpiry 回调的最短间隔
+func (a *Config) WithExpiryCooldown(cooldown time.Duration) *Config {
+	must.TRUE(cooldown > 0)
+	a.expiryCooldown = cooldown
+	return a
+}
+
+func (a *Config) afterTokenExpired(ctx context.Context, username string, LOG *log.Helper) {
+	if a.onExpiry == nil || !a.acquireExpiryHook(username) {
+		return
+	}
+	defer recoverHook("on_expiry", LOG)
+	a.onExpiry(ctx, username)
+}
+
+// acquireExpiryHook 判断这个用户是否已经过了冷却时长，是的时候记录这次回调的时间
+func (a *Config) acquireExpiryHook(username string) bool {
+	now := time.Now()
+
+	a.expiryMutex.Lock()
+	defer a.expiryMutex.Unlock()
+	if firedAt, ok := a.expiryFiredAt[username]; ok && now.Sub(firedAt) < a.expiryCooldown {
+		return false
+	}
+	if a.expiryFiredAt == nil {
+		a.expiryFiredAt = map[string]time.Time{}
+	}
+	a.expiryFiredAt[username] = now
+	return true
+}
+
+func (a *Config) afterAuthSuccess(ctx context.Context, operation string, LOG *log.Helper) {
+	a.metrics.IncAuthRequest(operation, metrics.ResultSuccess)
+	if a.onAuthSuccess != nil {
+		username, _ := GetUsername(ctx)
+		defer recoverHook("on_auth_success", LOG)
+		a.onAuthSuccess(ctx, username, operation)
+	}
+}
+
+func (a *Config) afterAuthFailure(ctx context.Context, operation string, erk *errors.Error, LOG *log.Helper) {
+	a.metrics.IncAuthRequest(operation, metrics.ResultFailure)
+	if a.onAuthFailure != nil {
+		defer recoverHook("on_auth_failure", LOG)
+		a.onAuthFailure(ctx, operation, erk)
+	}
+}
+
+// recoverHook 回调 panic 时只打印日志，不影响认证的结果
+func recoverHook(name string, LOG *log.Helper) {
+	if reason := recover(); reason != nil {
+		LOG.Errorf("check_auth: %s hook panic: %v", name, reason)
+	}
+}
@@ -0,0 +1,110 @@
+package authkratostokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithOnAuthSuccess(t *testing.T) {
+	type successEvent struct {
+		username  string
+		operation string
+	}
+	var successes []successEvent
+	var failures []*errors.Error
+	cfg := newTestConfig().
+		WithOnAuthSuccess(func(ctx context.Context, username string, operation string) {
+			successes = append(successes, successEvent{username: username, operation: operation})
+		}).
+		WithOnAuthFailure(func(ctx context.Context, operation string, err *errors.Error) {
+			require.Equal(t, "/a", operation)
+			failures = append(failures, err)
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "Bearer bob-token")
+	require.Nil(t, erk)
+	require.Equal(t, []successEvent{{"alice", "/a"}, {"bob", "/a"}}, successes)
+
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	_, erk = callWithToken(mw, "/a", "")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Len(t, failures, 2)
+	require.Equal(t, erk.Reason, failures[1].Reason)
+	require.Equal(t, erk.Message, failures[1].Message)
+
+	//不需要认证的接口不回调
+	_, erk = callWithToken(mw, "/b", "")
+	require.Nil(t, erk)
+	require.Len(t, successes, 2)
+	require.Len(t, failures, 2)
+}
+
+func TestConfig_WithOnAuthFailure_Panic(t *testing.T) {
+	cfg := newTestConfig().
+		WithOnAuthSuccess(func(ctx context.Context, username string, operation string) {
+			panic("success hook panic")
+		}).
+		WithOnAuthFailure(func(ctx context.Context, operation string, err *errors.Error) {
+			panic("failure hook panic")
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//回调 panic 不影响认证结果
+	ctx, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+	username, ok := GetUsername(ctx)
+	require.True(t, ok)
+	require.Equal(t, "alice", username)
+
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestConfig_WithOnExpiry(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	var expired []string
+	cfg := NewConfigWithExpiry("Authorization", map[string]TokenEntry{
+		"alice": {Password: "alice-token", ExpiresAt: time.Now().Add(-time.Second)},
+		"bob":   {Password: "bob-token", ExpiresAt: time.Now().Add(-time.Second)},
+		"carol": {Password: "carol-token"},
+	}, authkratosroutes.NewInclude("/a")).
+		WithExpiryCooldown(cooldown).
+		WithOnExpiry(func(ctx context.Context, username string) {
+			expired = append(expired, username)
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+	require.Equal(t, []string{"alice"}, expired)
+
+	//冷却时长内同一个用户不再回调，其它用户不受影响
+	_, erk = callWithToken(mw, "/a", "Bearer alice-token")
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+	_, erk = callWithToken(mw, "/a", "bob-token")
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+	require.Equal(t, []string{"alice", "bob"}, expired)
+
+	//没有过期和 token 不正确时不回调
+	_, erk = callWithToken(mw, "/a", "carol-token")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "wrong-token")
+	require.True(t, errors.IsUnauthorized(erk))
+	require.Equal(t, []string{"alice", "bob"}, expired)
+
+	time.Sleep(cooldown)
+	_, erk = callWithToken(mw, "/a", "alice-token")
+	require.Equal(t, "TOKEN_EXPIRED", erk.Reason)
+	require.Equal(t, []string{"alice", "bob", "alice"}, expired)
+}
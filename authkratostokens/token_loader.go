@@ -0,0 +1,60 @@
+package authkratostokens
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+)
+
+// TokenLoader 和 TokenSource 相同，创建配置时读取一次用 NewConfigWithLoader，需要定时刷新时再传给 WithTokenSource
+type TokenLoader = TokenSource
+
+// NewConfigWithLoader 和 NewConfig 相同，但是密码从 loader 读取，读取失败时 panic
+func NewConfigWithLoader(field string, loader TokenLoader, selectPath authkratosroutes.Matcher) *Config {
+	must.Full(loader)
+	tokens, err := loader.Load()
+	must.Done(err)
+	return NewConfig(field, tokens, selectPath)
+}
+
+type fileTokenLoader struct {
+	path string
+}
+
+// NewFileTokenLoader 从 json 文件读取用户名到密码的映射，格式是 {"username":"token"}，每次 Load 都重新读取文件
+// 因此也可以传给 WithTokenSource 实现密码文件修改后自动生效，比如挂载的 k8s secret
+func NewFileTokenLoader(path string) TokenLoader {
+	return &fileTokenLoader{path: path}
+}
+
+func (l *fileTokenLoader) Load() (map[string]string, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, erero.WithMessage(err, "open token file")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return LoadTokensFromReader(file)
+}
+
+// LoadTokensFromReader 从 json 读取用户名到密码的映射，格式是 {"username":"token"}，用户名和密码都不能为空
+func LoadTokensFromReader(reader io.Reader) (map[string]string, error) {
+	var tokens map[string]string
+	if err := json.NewDecoder(reader).Decode(&tokens); err != nil {
+		return nil, erero.WithMessage(err, "decode token json")
+	}
+	if len(tokens) == 0 {
+		return nil, erero.New("tokens is required")
+	}
+	for username, token := range tokens {
+		if username == "" || token == "" {
+			return nil, erero.Errorf("username=%q username and token are required", username)
+		}
+	}
+	return tokens, nil
+}
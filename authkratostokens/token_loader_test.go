@@ -0,0 +1,68 @@
+package authkratostokens
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTokenFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestNewConfigWithLoader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeTokenFile(t, path, `{"alice":"alice-token","bob":"bob-token"}`)
+
+	cfg := NewConfigWithLoader("Authorization", NewFileTokenLoader(path), authkratosroutes.NewInclude("/a"))
+	require.Equal(t, map[string]string{"alice": "alice-token", "bob": "bob-token"}, cfg.GetAuths())
+
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	ctx, erk := callWithToken(mw, "/a", "bob-token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "bob", username)
+
+	require.Panics(t, func() {
+		NewConfigWithLoader("Authorization", NewFileTokenLoader(filepath.Join(t.TempDir(), "missing.json")), authkratosroutes.NewAll())
+	})
+}
+
+func TestNewFileTokenLoader_WithTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	writeTokenFile(t, path, `{"alice":"alice-token"}`)
+
+	//文件修改后自动生效
+	loader := NewFileTokenLoader(path)
+	cfg := NewConfigWithLoader("Authorization", loader, authkratosroutes.NewInclude("/a")).WithTokenSource(loader, 10*time.Millisecond)
+	t.Cleanup(cfg.Close)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	_, erk := callWithToken(mw, "/a", "alice-token")
+	require.Nil(t, erk)
+
+	writeTokenFile(t, path, `{"alice":"alice-token-2"}`)
+	require.Eventually(t, func() bool {
+		_, erk := callWithToken(mw, "/a", "alice-token-2")
+		return erk == nil
+	}, time.Second, 5*time.Millisecond)
+	_, erk = callWithToken(mw, "/a", "alice-token")
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestLoadTokensFromReader(t *testing.T) {
+	tokens, err := LoadTokensFromReader(strings.NewReader(`{"alice":"alice-token"}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"alice": "alice-token"}, tokens)
+
+	for _, content := range []string{`not json`, `{}`, `{"alice":""}`, `{"":"token"}`, `["alice"]`} {
+		_, err := LoadTokensFromReader(strings.NewReader(content))
+		require.Error(t, err, content)
+	}
+}
@@ -0,0 +1,90 @@
+package authkratostokens
+
+import (
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/yyle88/must"
+)
+
+// TokenSource 提供用户名到密码的映射，比如从配置中心或者数据库读取，用于不重启服务就能轮换密码
+type TokenSource interface {
+	Load() (map[string]string, error)
+}
+
+type staticTokenSource map[string]string
+
+func (s staticTokenSource) Load() (map[string]string, error) {
+	return maps.Clone(map[string]string(s)), nil
+}
+
+// StaticTokenSource 返回固定的映射，和直接传给 NewConfig 的效果相同
+func StaticTokenSource(m map[string]string) TokenSource {
+	return staticTokenSource(maps.Clone(m))
+}
+
+// WithTokenSource 设置密码的来源，第一次创建中间件时读取一次，之后每 refreshInterval 时长在后台重新读取并替换
+// 读取失败时打印日志并继续使用上次的密码，读取成功前使用 NewConfig 传入的密码
+// 同一个配置创建的多个中间件共用一个后台协程，服务退出时调用 Close 停止
+func (a *Config) WithTokenSource(source TokenSource, refreshInterval time.Duration) *Config {
+	must.Full(source)
+	must.TRUE(refreshInterval > 0)
+	a.tokenSource = source
+	a.refreshInterval = refreshInterval
+	a.closing = make(chan struct{})
+	return a
+}
+
+// Close 停止 WithTokenSource 启动的后台刷新协程，之后中间件继续使用最后一次读取的密码，可以多次调用
+// 没有设置 TokenSource 时什么都不做
+func (a *Config) Close() {
+	if a.closing == nil {
+		return
+	}
+	a.closeOnce.Do(func() {
+		close(a.closing)
+	})
+}
+
+// newMapBoxRef 创建可以原子替换的映射，设置了 TokenSource 时返回配置共用的映射，第一次调用时启动后台协程定时刷新
+func (a *Config) newMapBoxRef(LOG *log.Helper) *atomic.Pointer[authTokenMapBox] {
+	if a.tokenSource == nil {
+		var mapBoxRef = &atomic.Pointer[authTokenMapBox]{}
+		mapBoxRef.Store(newAuthTokenMapBox(a.tokens, a.prefixes, a.timingSafe))
+		return mapBoxRef
+	}
+	a.refreshOnce.Do(func() {
+		a.refreshRef = &atomic.Pointer[authTokenMapBox]{}
+		a.refreshRef.Store(newAuthTokenMapBox(a.tokens, a.prefixes, a.timingSafe))
+		a.reloadMapBox(a.refreshRef, LOG)
+		go a.refreshMapBox(a.refreshRef, a.closing, LOG)
+	})
+	return a.refreshRef
+}
+
+// refreshMapBox 定时重新读取密码，直到 Close 被调用
+func (a *Config) refreshMapBox(mapBoxRef *atomic.Pointer[authTokenMapBox], closing <-chan struct{}, LOG *log.Helper) {
+	ticker := time.NewTicker(a.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closing:
+			LOG.Debugf("check_auth: stop reloading tokens")
+			return
+		case <-ticker.C:
+			a.reloadMapBox(mapBoxRef, LOG)
+		}
+	}
+}
+
+func (a *Config) reloadMapBox(mapBoxRef *atomic.Pointer[authTokenMapBox], LOG *log.Helper) {
+	tokens, err := a.tokenSource.Load()
+	if err != nil {
+		LOG.Warnf("check_auth: reload tokens error:%v so keep using old tokens", err)
+		return
+	}
+	mapBoxRef.Store(newAuthTokenMapBox(tokens, a.prefixes, a.timingSafe))
+	LOG.Debugf("check_auth: reload tokens count:%v", len(tokens))
+}
@@ -0,0 +1,116 @@
+package authkratostokens
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+)
+
+// mutableTokenSource 单测里模拟配置中心，可以随时修改密码
+type mutableTokenSource struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+	err    error
+}
+
+func (s *mutableTokenSource) Load() (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tokens, s.err
+}
+
+func (s *mutableTokenSource) set(tokens map[string]string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens, s.err = tokens, err
+}
+
+func TestConfig_WithTokenSource(t *testing.T) {
+	source := &mutableTokenSource{tokens: map[string]string{"alice": "alice-token-1"}}
+	cfg := newTestConfig().WithTokenSource(source, 10*time.Millisecond)
+	t.Cleanup(cfg.Close)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//创建时就读取了一次，因此 NewConfig 传入的密码不再生效
+	_, erk := callWithToken(mw, "/a", "alice-token-1")
+	require.Nil(t, erk)
+	_, erk = callWithToken(mw, "/a", "bob-token")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	source.set(map[string]string{"alice": "alice-token-2"}, nil)
+	require.Eventually(t, func() bool {
+		_, erk := callWithToken(mw, "/a", "alice-token-2")
+		return erk == nil
+	}, time.Second, 10*time.Millisecond)
+	_, erk = callWithToken(mw, "/a", "alice-token-1")
+	require.True(t, errors.IsUnauthorized(erk))
+
+	//读取失败时继续使用上次的密码
+	source.set(nil, erero.New("config center unavailable"))
+	time.Sleep(50 * time.Millisecond)
+	_, erk = callWithToken(mw, "/a", "alice-token-2")
+	require.Nil(t, erk)
+}
+
+// countingTokenSource 统计 Load 被调用的次数
+type countingTokenSource struct {
+	count atomic.Int64
+}
+
+func (s *countingTokenSource) Load() (map[string]string, error) {
+	s.count.Add(1)
+	return map[string]string{"alice": "alice-token"}, nil
+}
+
+func TestConfig_Close(t *testing.T) {
+	source := &countingTokenSource{}
+	cfg := newTestConfig().WithTokenSource(source, 5*time.Millisecond)
+
+	//多个中间件共用一个后台协程，创建时只读取一次
+	mw1 := NewMiddleware(cfg, log.DefaultLogger)
+	mw2 := NewMiddleware(cfg, log.DefaultLogger)
+	require.Equal(t, int64(1), source.count.Load())
+	require.Eventually(t, func() bool {
+		return source.count.Load() >= 3
+	}, time.Second, 5*time.Millisecond)
+
+	cfg.Close()
+	cfg.Close()
+	time.Sleep(20 * time.Millisecond)
+	count := source.count.Load()
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, count, source.count.Load())
+
+	//停止以后继续使用最后一次读取的密码
+	for _, mw := range []middleware.Middleware{mw1, mw2} {
+		_, erk := callWithToken(mw, "/a", "alice-token")
+		require.Nil(t, erk)
+	}
+
+	newTestConfig().Close()
+}
+
+func TestStaticTokenSource(t *testing.T) {
+	tokens := map[string]string{"alice": "alice-token"}
+	source := StaticTokenSource(tokens)
+	tokens["alice"] = "changed"
+
+	res, err := source.Load()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"alice": "alice-token"}, res)
+
+	cfg := NewConfig("Authorization", nil, authkratosroutes.NewInclude("/a")).WithTokenSource(source, time.Hour)
+	t.Cleanup(cfg.Close)
+	ctx, erk := callWithToken(NewMiddleware(cfg, log.DefaultLogger), "/a", "alice-token")
+	require.Nil(t, erk)
+	username, _ := GetUsername(ctx)
+	require.Equal(t, "alice", username)
+}
@@ -0,0 +1,67 @@
+package authkratostokens
+
+import (
+	"io"
+
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/yyle88/erero"
+	"gopkg.in/yaml.v3"
+)
+
+type yamlConfig struct {
+	FieldName  string          `yaml:"field_name"`
+	Tokens     []yamlToken     `yaml:"tokens"`
+	RouteScope *yamlRouteScope `yaml:"route_scope"`
+}
+
+type yamlToken struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type yamlRouteScope struct {
+	Side       authkratosroutes.SelectSide `yaml:"side"`
+	Operations []authkratosroutes.Path     `yaml:"operations"`
+}
+
+// NewConfigFromYAML 从 yaml 里读取配置，便于把大量服务账号和服务的部署清单放在一起管理
+// 格式是 {"field_name":"Authorization","tokens":[{"username":"alice","password":"..."}],"route_scope":{"side":"INCLUDE","operations":["..."]}}
+// 不认识的字段会报错，避免把字段名写错而不生效
+func NewConfigFromYAML(reader io.Reader) (*Config, error) {
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+
+	var config yamlConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, erero.WithMessage(err, "decode yaml config")
+	}
+	if config.FieldName == "" {
+		return nil, erero.New("field_name is required")
+	}
+	if len(config.Tokens) == 0 {
+		return nil, erero.New("tokens is required")
+	}
+	var tokens = make(map[string]string, len(config.Tokens))
+	for idx, token := range config.Tokens {
+		if token.Username == "" || token.Password == "" {
+			return nil, erero.Errorf("tokens[%d] username and password are required", idx)
+		}
+		if _, ok := tokens[token.Username]; ok {
+			return nil, erero.Errorf("tokens[%d] username=%s is duplicated", idx, token.Username)
+		}
+		tokens[token.Username] = token.Password
+	}
+	if config.RouteScope == nil {
+		return nil, erero.New("route_scope is required")
+	}
+	var selectPath *authkratosroutes.SelectPath
+	switch config.RouteScope.Side {
+	case authkratosroutes.INCLUDE:
+		selectPath = authkratosroutes.NewInclude(config.RouteScope.Operations...)
+	case authkratosroutes.EXCLUDE:
+		selectPath = authkratosroutes.NewExclude(config.RouteScope.Operations...)
+	default:
+		return nil, erero.Errorf("route_scope side=%s is invalid", config.RouteScope.Side)
+	}
+	return NewConfig(config.FieldName, tokens, selectPath), nil
+}
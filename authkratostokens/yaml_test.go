@@ -0,0 +1,76 @@
+package authkratostokens
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigFromYAML(t *testing.T) {
+	const text = `
+field_name: Authorization
+tokens:
+  - username: alice
+    password: alice-token
+  - username: bob
+    password: bob-token
+route_scope:
+  side: INCLUDE
+  operations:
+    - /a
+    - /b
+`
+	cfg, err := NewConfigFromYAML(strings.NewReader(text))
+	require.NoError(t, err)
+	require.Equal(t, "Authorization", cfg.GetField())
+	require.Equal(t, map[string]string{"alice": "alice-token", "bob": "bob-token"}, cfg.GetAuths())
+	require.Equal(t, authkratosroutes.INCLUDE, authkratosroutes.SideOf(cfg.selectPath))
+	require.True(t, cfg.selectPath.Match("/a"))
+	require.True(t, cfg.selectPath.Match("/b"))
+	require.False(t, cfg.selectPath.Match("/c"))
+}
+
+func TestNewConfigFromYAML_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"missing-field-name": `
+tokens: [{username: alice, password: x}]
+route_scope: {side: INCLUDE, operations: [/a]}
+`,
+		"missing-tokens": `
+field_name: Authorization
+route_scope: {side: INCLUDE, operations: [/a]}
+`,
+		"missing-password": `
+field_name: Authorization
+tokens: [{username: alice}]
+route_scope: {side: INCLUDE, operations: [/a]}
+`,
+		"duplicated-username": `
+field_name: Authorization
+tokens: [{username: alice, password: x}, {username: alice, password: y}]
+route_scope: {side: INCLUDE, operations: [/a]}
+`,
+		"missing-route-scope": `
+field_name: Authorization
+tokens: [{username: alice, password: x}]
+`,
+		"invalid-side": `
+field_name: Authorization
+tokens: [{username: alice, password: x}]
+route_scope: {side: BOTH, operations: [/a]}
+`,
+		"unknown-field": `
+field_name: Authorization
+tokens: [{username: alice, password: x}]
+route_scope: {side: INCLUDE, operations: [/a]}
+enable: true
+`,
+	}
+	for name, text := range testCases {
+		_, err := NewConfigFromYAML(strings.NewReader(text))
+		require.Error(t, err, name)
+		t.Log(name, err)
+	}
+}
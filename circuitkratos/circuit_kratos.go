@@ -0,0 +1,238 @@
+package circuitkratos
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+)
+
+type CircuitState string
+
+const (
+	CLOSED    CircuitState = "CLOSED"    //正常放行，统计连续失败次数
+	OPEN      CircuitState = "OPEN"      //直接拒绝，直到 openDuration 过去
+	HALF_OPEN CircuitState = "HALF_OPEN" //只放行一个探测请求，成功时关闭，失败时重新打开
+)
+
+// Config 按 operation 分别熔断，每个 operation 有自己的状态
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	failureThreshold  int
+	openDuration      time.Duration
+	circuits          sync.Map // operation -> *circuit
+	isFailure         func(err error) bool
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher, failureThreshold int, openDuration time.Duration) *Config {
+	must.TRUE(failureThreshold > 0)
+	must.TRUE(openDuration > 0)
+	return &Config{
+		selectPath:       selectPath,
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		isFailure:        IsServerFailure,
+		enable:           true,
+	}
+}
+
+// IsServerFailure 默认的失败判断，只把 5xx 错误和不是 kratos 错误的传输错误算作失败
+// 4xx 是客户端的问题，比如认证失败和参数错误，不应该让下游熔断
+func IsServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.FromError(err).Code >= http.StatusInternalServerError
+}
+
+// WithFailurePredicate 设置判断请求失败的函数，返回 true 的请求会累计失败次数，默认是 IsServerFailure
+func (a *Config) WithFailurePredicate(isFailure func(err error) bool) *Config {
+	must.TRUE(isFailure != nil)
+	a.isFailure = isFailure
+	return a
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印是否被熔断拒绝的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// GetCircuitState 返回 operation 当前的状态，用于监控，没有请求过的 operation 是 CLOSED
+// 打开的时间超过 openDuration 时返回 HALF_OPEN，表示下一个请求会作为探测请求放行
+func (a *Config) GetCircuitState(operation string) CircuitState {
+	value, ok := a.circuits.Load(operation)
+	if !ok {
+		return CLOSED
+	}
+	return value.(*circuit).getState(a.openDuration)
+}
+
+func (a *Config) getCircuit(operation string) *circuit {
+	if value, ok := a.circuits.Load(operation); ok {
+		return value.(*circuit)
+	}
+	value, _ := a.circuits.LoadOrStore(operation, &circuit{state: CLOSED})
+	return value.(*circuit)
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	mutex    sync.Mutex
+}
+
+func (c *circuit) getState(openDuration time.Duration) CircuitState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state == OPEN && time.Since(c.openedAt) >= openDuration {
+		return HALF_OPEN
+	}
+	return c.state
+}
+
+// allow 判断请求能否放行，打开的时间够了时转为 HALF_OPEN 并把这个请求作为探测请求
+func (c *circuit) allow(openDuration time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.state {
+	case CLOSED:
+		return true
+	case OPEN:
+		if time.Since(c.openedAt) < openDuration {
+			return false
+		}
+		c.state = HALF_OPEN
+		c.probing = true
+		return true
+	case HALF_OPEN:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	default:
+		panic(c.state)
+	}
+}
+
+// record 记录请求结果，熔断打开之前就已经放行的请求结果不影响状态
+func (c *circuit) record(failed bool, failureThreshold int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.state {
+	case CLOSED:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= failureThreshold {
+			c.open()
+		}
+	case HALF_OPEN:
+		c.probing = false
+		if failed {
+			c.open()
+		} else {
+			c.state = CLOSED
+			c.failures = 0
+		}
+	}
+}
+
+func (c *circuit) open() {
+	c.state = OPEN
+	c.openedAt = time.Now()
+	c.failures = 0
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new circuit middleware enable=%v failure_threshold=%v open_duration=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.failureThreshold,
+		cfg.openDuration,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("circuit", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must check circuit", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip check circuit", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("circuit: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			var operation string
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				operation = tp.Operation()
+			}
+			circuit := cfg.getCircuit(operation)
+			if !circuit.allow(cfg.openDuration) {
+				LOG.Warnf("circuit: operation=%s circuit is open so reject requests", operation)
+				return nil, errors.New(http.StatusServiceUnavailable, "CIRCUIT_OPEN", "circuit: circuit is open")
+			}
+			//handler panic 时也需要记录结果，否则探测请求一直占着 HALF_OPEN 状态
+			var failed = true
+			defer func() {
+				circuit.record(failed, cfg.failureThreshold)
+			}()
+			resp, err := handleFunc(ctx, req)
+			failed = cfg.isFailure(err)
+			return resp, err
+		}
+	}
+}
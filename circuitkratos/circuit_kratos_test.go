@@ -0,0 +1,160 @@
+package circuitkratos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+var errDownstream = errors.InternalServer("DOWNSTREAM", "downstream failure")
+
+func callOnce(mw middleware.Middleware, operation string, fail bool) error {
+	ctx := kratosmock.NewHTTPTransport(operation).NewContext(context.Background())
+	_, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+		if fail {
+			return nil, errDownstream
+		}
+		return "ok", nil
+	})(ctx, nil)
+	return err
+}
+
+func TestNewMiddleware(t *testing.T) {
+	const openDuration = 50 * time.Millisecond
+
+	cfg := NewConfig(authkratosroutes.NewAll(), 3, openDuration)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+
+	//成功的请求会重置连续失败次数
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.NoError(t, callOnce(mw, "/a", false))
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+
+	//连续失败达到阈值时打开
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.Equal(t, OPEN, cfg.GetCircuitState("/a"))
+	erk := callOnce(mw, "/a", false)
+	require.Equal(t, "CIRCUIT_OPEN", errors.Reason(erk))
+	require.Equal(t, 503, int(errors.Code(erk)))
+
+	//其它 operation 不受影响
+	require.NoError(t, callOnce(mw, "/b", false))
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/b"))
+
+	//过了 openDuration 后探测失败，重新打开
+	time.Sleep(openDuration)
+	require.Equal(t, HALF_OPEN, cfg.GetCircuitState("/a"))
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.Equal(t, OPEN, cfg.GetCircuitState("/a"))
+	require.Equal(t, "CIRCUIT_OPEN", errors.Reason(callOnce(mw, "/a", false)))
+
+	//过了 openDuration 后探测成功，关闭
+	time.Sleep(openDuration)
+	require.NoError(t, callOnce(mw, "/a", false))
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+	require.NoError(t, callOnce(mw, "/a", false))
+}
+
+func TestNewMiddleware_HalfOpenSingleProbe(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+
+	cfg := NewConfig(authkratosroutes.NewAll(), 1, openDuration)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.Error(t, callOnce(mw, "/a", true))
+	time.Sleep(openDuration)
+
+	//探测请求还没有返回时其它请求被拒绝
+	probing := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+		_, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+			close(probing)
+			<-finish
+			return "ok", nil
+		})(ctx, nil)
+		done <- err
+	}()
+	<-probing
+	require.Equal(t, HALF_OPEN, cfg.GetCircuitState("/a"))
+	require.Equal(t, "CIRCUIT_OPEN", errors.Reason(callOnce(mw, "/a", false)))
+	close(finish)
+	require.NoError(t, <-done)
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+}
+
+func TestNewMiddleware_Skip(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), 1, time.Minute)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.Error(t, callOnce(mw, "/b", true))
+	require.Error(t, callOnce(mw, "/b", true))
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/b"))
+	require.ErrorIs(t, callOnce(mw, "/b", true), errDownstream)
+}
+
+func TestNewMiddleware_ClientError(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll(), 1, time.Minute)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//4xx 错误不算失败
+	ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+	_, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.Unauthorized("UNAUTHORIZED", "wrong token")
+	})(ctx, nil)
+	require.True(t, errors.IsUnauthorized(err))
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+
+	require.ErrorIs(t, callOnce(mw, "/a", true), errDownstream)
+	require.Equal(t, OPEN, cfg.GetCircuitState("/a"))
+}
+
+func TestConfig_WithFailurePredicate(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll(), 1, time.Minute).WithFailurePredicate(func(err error) bool {
+		return err != nil
+	})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+	_, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.BadRequest("BAD_REQUEST", "wrong param")
+	})(ctx, nil)
+	require.True(t, errors.IsBadRequest(err))
+	require.Equal(t, OPEN, cfg.GetCircuitState("/a"))
+}
+
+func TestNewMiddleware_ProbePanic(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+
+	cfg := NewConfig(authkratosroutes.NewAll(), 1, openDuration)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.Error(t, callOnce(mw, "/a", true))
+	time.Sleep(openDuration)
+
+	//探测请求 panic 时算作失败，重新打开，过了 openDuration 后依然可以再次探测
+	ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+	require.Panics(t, func() {
+		_, _ = mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("handler panic")
+		})(ctx, nil)
+	})
+	require.Equal(t, OPEN, cfg.GetCircuitState("/a"))
+	time.Sleep(openDuration)
+	require.NoError(t, callOnce(mw, "/a", false))
+	require.Equal(t, CLOSED, cfg.GetCircuitState("/a"))
+}
@@ -0,0 +1,15 @@
+package correlationkratos
+
+import "context"
+
+type correlationIDKey struct{}
+
+func SetCorrelationIDIntoContext(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// GetCorrelationID 在 handler 里获取关联 ID
+func GetCorrelationID(ctx context.Context) (string, bool) {
+	correlationID, ok := ctx.Value(correlationIDKey{}).(string)
+	return correlationID, ok
+}
@@ -0,0 +1,141 @@
+package correlationkratos
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/google/uuid"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type Config struct {
+	field             string
+	selectPath        authkratosroutes.Matcher
+	validateFunc      func(string) bool
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher) *Config {
+	return &Config{
+		field:        "X-Correlation-ID",
+		selectPath:   selectPath,
+		validateFunc: uuidPattern.MatchString,
+		enable:       true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable && a.field != ""
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印传递 correlation id 的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithFieldName 设置关联 ID 的请求头，默认是 X-Correlation-ID
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+// WithValidateFunc 设置校验关联 ID 的函数，默认要求是 UUID 格式，校验不过时重新生成
+func (a *Config) WithValidateFunc(validateFunc func(string) bool) *Config {
+	a.validateFunc = validateFunc
+	return a
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new correlation middleware enable=%v field=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("correlation", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must set correlation id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip set correlation id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("correlation: cfg.enable=false pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				correlationID := tp.RequestHeader().Get(cfg.field)
+				if correlationID != "" && !cfg.validateFunc(correlationID) {
+					LOG.Debugf("correlation: invalid correlation id length=%d so generate new one", len(correlationID))
+					correlationID = ""
+				}
+				if correlationID == "" {
+					correlationID = uuid.NewString()
+				}
+				tp.ReplyHeader().Set(cfg.field, correlationID)
+				ctx = SetCorrelationIDIntoContext(ctx, correlationID)
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
+
+// NewClientMiddleware 在调用下游服务时把 context 里的关联 ID 写进请求头，用于 kratos 的 client
+func NewClientMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromClientContext(ctx); ok {
+				if correlationID, ok := GetCorrelationID(ctx); ok {
+					tp.RequestHeader().Set(cfg.field, correlationID)
+				} else {
+					LOG.Debugf("correlation: operation=%s no correlation id in context", tp.Operation())
+				}
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package correlationkratos
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	kratoshttp "github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/google/uuid"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	correlationID, _ := GetCorrelationID(ctx)
+	return correlationID, nil
+}
+
+func callOnce(cfg *Config, tp *kratosmock.Transport) string {
+	res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		panic(err)
+	}
+	return res.(string)
+}
+
+func TestNewMiddleware(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll())
+
+	const correlationID = "5f0e9c1a-7d5b-4b7e-9a3c-2f1d6e8b4a90"
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Correlation-ID", correlationID)
+	require.Equal(t, correlationID, callOnce(cfg, tp))
+	require.Equal(t, correlationID, tp.ReplyHeader().Get("X-Correlation-ID"))
+
+	//不是 UUID 格式时重新生成
+	tp = kratosmock.NewGRPCTransport("/a").WithHeader("X-Correlation-ID", "not-uuid")
+	res := callOnce(cfg, tp)
+	require.NotEqual(t, "not-uuid", res)
+	_, err := uuid.Parse(res)
+	require.NoError(t, err)
+
+	tp = kratosmock.NewHTTPTransport("/a")
+	require.Empty(t, callOnce(NewConfig(authkratosroutes.NewNone()), tp))
+}
+
+func TestConfig_WithValidateFunc(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithValidateFunc(func(s string) bool { return s != "" })
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Correlation-ID", "not-uuid")
+	require.Equal(t, "not-uuid", callOnce(cfg, tp))
+}
+
+type correlationReply struct {
+	CorrelationID string `json:"correlation_id"`
+}
+
+// startServer 启动一个 kratos HTTP 服务，在 GET /id 里调用 handle 返回结果
+func startServer(t *testing.T, cfg *Config, handle func(ctx context.Context) (*correlationReply, error)) string {
+	srv := kratoshttp.NewServer(
+		kratoshttp.Address("127.0.0.1:0"),
+		kratoshttp.Middleware(NewMiddleware(cfg, log.DefaultLogger)),
+	)
+	srv.Route("/").GET("/id", func(ctx kratoshttp.Context) error {
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return handle(ctx)
+		})
+		res, err := h(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(http.StatusOK, res)
+	})
+	endpoint, err := srv.Endpoint()
+	require.NoError(t, err)
+
+	go func() {
+		_ = srv.Start(context.Background())
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, srv.Stop(context.Background()))
+	})
+	return endpoint.Host
+}
+
+func newClient(t *testing.T, cfg *Config, endpoint string, middlewares ...middleware.Middleware) *kratoshttp.Client {
+	client, err := kratoshttp.NewClient(
+		context.Background(),
+		kratoshttp.WithEndpoint(endpoint),
+		kratoshttp.WithTimeout(5*time.Second),
+		kratoshttp.WithMiddleware(append([]middleware.Middleware{NewClientMiddleware(cfg, log.DefaultLogger)}, middlewares...)...),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+	return client
+}
+
+func TestNewClientMiddleware_Chain(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll())
+
+	endpointB := startServer(t, cfg, func(ctx context.Context) (*correlationReply, error) {
+		correlationID, _ := GetCorrelationID(ctx)
+		return &correlationReply{CorrelationID: correlationID}, nil
+	})
+	clientB := newClient(t, cfg, endpointB)
+
+	endpointA := startServer(t, cfg, func(ctx context.Context) (*correlationReply, error) {
+		//服务 A 调用服务 B，关联 ID 通过 client 中间件传递
+		var reply correlationReply
+		if err := clientB.Invoke(ctx, http.MethodGet, "/id", nil, &reply); err != nil {
+			return nil, err
+		}
+		return &reply, nil
+	})
+	clientA := newClient(t, cfg, endpointA)
+
+	const correlationID = "5f0e9c1a-7d5b-4b7e-9a3c-2f1d6e8b4a90"
+	ctx := SetCorrelationIDIntoContext(context.Background(), correlationID)
+	var reply correlationReply
+	require.NoError(t, clientA.Invoke(ctx, http.MethodGet, "/id", nil, &reply))
+	require.Equal(t, correlationID, reply.CorrelationID)
+
+	//入口没有关联 ID 时由服务 A 生成，服务 B 收到的是同一个
+	var header http.Header
+	reply = correlationReply{}
+	require.NoError(t, clientA.Invoke(context.Background(), http.MethodGet, "/id", nil, &reply, kratoshttp.Header(&header)))
+	require.NotEmpty(t, reply.CorrelationID)
+	require.Equal(t, header.Get("X-Correlation-ID"), reply.CorrelationID)
+}
@@ -0,0 +1,126 @@
+package kratosmock
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/peer"
+)
+
+// Transport 模拟 kratos 服务端的 transport，供单测构造带 operation 和 header 的请求上下文
+// 同时实现 transport.Transporter 和 kratos http.Transporter 接口
+type Transport struct {
+	kind        transport.Kind
+	operation   string
+	reqHeader   headerCarrier
+	replyHeader headerCarrier
+	request     *http.Request
+	remoteAddr  string
+}
+
+func NewHTTPTransport(operation string) *Transport {
+	request, err := http.NewRequest(http.MethodPost, "http://127.0.0.1"+operation, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &Transport{
+		kind:        transport.KindHTTP,
+		operation:   operation,
+		reqHeader:   headerCarrier(request.Header),
+		replyHeader: headerCarrier{},
+		request:     request,
+	}
+}
+
+func NewGRPCTransport(operation string) *Transport {
+	return &Transport{
+		kind:        transport.KindGRPC,
+		operation:   operation,
+		reqHeader:   headerCarrier{},
+		replyHeader: headerCarrier{},
+	}
+}
+
+// WithHeader 设置请求头，便于链式构造
+func (t *Transport) WithHeader(key string, value string) *Transport {
+	t.reqHeader.Set(key, value)
+	return t
+}
+
+// WithRemoteAddr 设置对端地址，http 时写进 Request().RemoteAddr，grpc 时在 NewContext 里放进 peer 信息
+func (t *Transport) WithRemoteAddr(addr string) *Transport {
+	t.remoteAddr = addr
+	if t.request != nil {
+		t.request.RemoteAddr = addr
+	}
+	return t
+}
+
+// NewContext 把 transport 放进服务端上下文里，这样 selector 和中间件就能取到 operation 和 header
+func (t *Transport) NewContext(ctx context.Context) context.Context {
+	if t.kind == transport.KindGRPC && t.remoteAddr != "" {
+		addr, err := net.ResolveTCPAddr("tcp", t.remoteAddr)
+		if err != nil {
+			panic(err)
+		}
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	return transport.NewServerContext(ctx, t)
+}
+
+func (t *Transport) Kind() transport.Kind {
+	return t.kind
+}
+
+func (t *Transport) Endpoint() string {
+	return string(t.kind) + "://127.0.0.1"
+}
+
+func (t *Transport) Operation() string {
+	return t.operation
+}
+
+func (t *Transport) RequestHeader() transport.Header {
+	return t.reqHeader
+}
+
+func (t *Transport) ReplyHeader() transport.Header {
+	return t.replyHeader
+}
+
+// Request 仅 http 时有值，grpc 时返回 nil
+func (t *Transport) Request() *http.Request {
+	return t.request
+}
+
+func (t *Transport) PathTemplate() string {
+	return t.operation
+}
+
+type headerCarrier http.Header
+
+func (hc headerCarrier) Get(key string) string {
+	return http.Header(hc).Get(key)
+}
+
+func (hc headerCarrier) Set(key string, value string) {
+	http.Header(hc).Set(key, value)
+}
+
+func (hc headerCarrier) Add(key string, value string) {
+	http.Header(hc).Add(key, value)
+}
+
+func (hc headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(hc))
+	for k := range http.Header(hc) {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (hc headerCarrier) Values(key string) []string {
+	return http.Header(hc).Values(key)
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ResultSuccess  = "success"
+	ResultFailure  = "failure"
+	ResultAllowed  = "allowed"
+	ResultRejected = "rejected"
+)
+
+// Metrics 懒注册的 prometheus 指标，第一次计数时才注册，多个中间件注册到同一个 Registerer 时共用同一个指标
+type Metrics struct {
+	reg                 prometheus.Registerer
+	once                sync.Once
+	authRequests        *prometheus.CounterVec
+	rateLimitRequests   *prometheus.CounterVec
+	rateLimitRejections *prometheus.CounterVec
+}
+
+func New(reg prometheus.Registerer) *Metrics {
+	return &Metrics{reg: reg}
+}
+
+func (m *Metrics) register() {
+	m.once.Do(func() {
+		m.authRequests = mustRegister(m.reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authkratos_auth_requests_total",
+			Help: "Total number of requests checked by authkratos middlewares.",
+		}, []string{"operation", "result"}))
+		m.rateLimitRequests = mustRegister(m.reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authkratos_rate_limit_requests_total",
+			Help: "Total number of requests checked by authkratos rate limit middlewares.",
+		}, []string{"operation", "result"}))
+		//不使用限流的 key 作为标签，key 通常是用户或 IP，会让指标的基数无限增长
+		m.rateLimitRejections = mustRegister(m.reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authkratos_rate_limit_rejections_total",
+			Help: "Total number of requests rejected by authkratos rate limit middlewares.",
+		}, []string{"operation"}))
+	})
+}
+
+// mustRegister 和 prometheus.MustRegister 相同，只是已经注册过时使用已有的指标
+func mustRegister(reg prometheus.Registerer, counterVec *prometheus.CounterVec) *prometheus.CounterVec {
+	if err := reg.Register(counterVec); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.CounterVec)
+		}
+		panic(err)
+	}
+	return counterVec
+}
+
+// IncAuthRequest 没有设置指标时 m 是 nil，这时什么都不做
+func (m *Metrics) IncAuthRequest(operation string, result string) {
+	if m == nil {
+		return
+	}
+	m.register()
+	m.authRequests.WithLabelValues(operation, result).Inc()
+}
+
+// IncRateLimitRequest 统计限流结果，result 是 ResultAllowed 或 ResultRejected，被限流时同时统计到 rejections 指标
+func (m *Metrics) IncRateLimitRequest(operation string, result string) {
+	if m == nil {
+		return
+	}
+	m.register()
+	m.rateLimitRequests.WithLabelValues(operation, result).Inc()
+	if result == ResultRejected {
+		m.rateLimitRejections.WithLabelValues(operation).Inc()
+	}
+}
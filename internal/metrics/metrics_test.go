@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_IncAuthRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m1 := New(reg)
+	m2 := New(reg)
+
+	//两个中间件注册到同一个 Registerer 时共用指标
+	m1.IncAuthRequest("/a", ResultSuccess)
+	m2.IncAuthRequest("/a", ResultSuccess)
+	m2.IncAuthRequest("/a", ResultFailure)
+	require.Equal(t, float64(2), testutil.ToFloat64(m1.authRequests.WithLabelValues("/a", ResultSuccess)))
+	require.Equal(t, float64(1), testutil.ToFloat64(m2.authRequests.WithLabelValues("/a", ResultFailure)))
+
+	m1.IncRateLimitRequest("/a", ResultAllowed)
+	m1.IncRateLimitRequest("/a", ResultRejected)
+	require.Equal(t, float64(1), testutil.ToFloat64(m2.rateLimitRequests.WithLabelValues("/a", ResultAllowed)))
+	require.Equal(t, float64(1), testutil.ToFloat64(m2.rateLimitRejections.WithLabelValues("/a")))
+
+	var m *Metrics
+	m.IncAuthRequest("/a", ResultSuccess)
+	m.IncRateLimitRequest("/a", ResultRejected)
+}
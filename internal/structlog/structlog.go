@@ -0,0 +1,55 @@
+package structlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// 每次请求的判断结果
+const (
+	DecisionPass   = "pass"   //中间件调用了下一层
+	DecisionReject = "reject" //中间件直接返回了错误
+)
+
+// Wrap 包装中间件，每次请求打印一条结构化的 debug 日志，便于日志系统解析，各个中间件的 WithStructuredLogging 都使用这里
+// 日志的字段:
+//   - operation: 请求的 operation，上下文里没有 transport 时是空字符串
+//   - decision: 中间件调用了下一层时是 pass，直接返回错误时是 reject
+//   - latency_ns: 中间件调用下一层之前花费的时长，即判断本身的耗时，不包括 handler 的耗时，reject 时是中间件的全部耗时
+//   - reason: 只有 reject 时才有，是返回的 kratos 错误的 reason
+//
+// enable 是 false 时原样返回中间件
+func Wrap(name string, enable bool, mw middleware.Middleware, LOGGER log.Logger) middleware.Middleware {
+	if !enable {
+		return mw
+	}
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var operation string
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				operation = tp.Operation()
+			}
+			var passed = false
+			var latency time.Duration
+			startTime := time.Now()
+			res, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+				passed = true
+				latency = time.Since(startTime)
+				return handleFunc(ctx, req)
+			})(ctx, req)
+			if passed {
+				LOG.Debugw(log.DefaultMessageKey, name+": decision", "operation", operation, "decision", DecisionPass, "latency_ns", latency.Nanoseconds())
+			} else {
+				LOG.Debugw(log.DefaultMessageKey, name+": decision", "operation", operation, "decision", DecisionReject, "latency_ns", time.Since(startTime).Nanoseconds(), "reason", errors.Reason(err))
+			}
+			return res, err
+		}
+	}
+}
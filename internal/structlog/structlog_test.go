@@ -0,0 +1,73 @@
+package structlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+// recordLogger 按 key-value 记录每条日志
+type recordLogger struct {
+	records []map[string]interface{}
+}
+
+func (l *recordLogger) Log(level log.Level, keyvals ...interface{}) error {
+	record := map[string]interface{}{"level": level}
+	for idx := 0; idx+1 < len(keyvals); idx += 2 {
+		record[keyvals[idx].(string)] = keyvals[idx+1]
+	}
+	l.records = append(l.records, record)
+	return nil
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+// rejectMiddleware token 不是 abc 时拒绝
+func rejectMiddleware(handleFunc middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		if req != "abc" {
+			return nil, errors.Unauthorized("UNAUTHORIZED", "wrong")
+		}
+		return handleFunc(ctx, req)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	LOGGER := &recordLogger{}
+	mw := Wrap("check_auth", true, rejectMiddleware, LOGGER)
+	ctx := kratosmock.NewHTTPTransport("/a").NewContext(context.Background())
+
+	res, err := mw(handleFunc)(ctx, "abc")
+	require.NoError(t, err)
+	require.Equal(t, "ok", res)
+	_, err = mw(handleFunc)(ctx, "wrong")
+	require.True(t, errors.IsUnauthorized(err))
+
+	require.Len(t, LOGGER.records, 2)
+	require.Equal(t, log.LevelDebug, LOGGER.records[0]["level"])
+	require.Equal(t, "check_auth: decision", LOGGER.records[0][log.DefaultMessageKey])
+	require.Equal(t, "/a", LOGGER.records[0]["operation"])
+	require.Equal(t, DecisionPass, LOGGER.records[0]["decision"])
+	require.IsType(t, int64(0), LOGGER.records[0]["latency_ns"])
+	require.Equal(t, DecisionReject, LOGGER.records[1]["decision"])
+	require.Equal(t, "UNAUTHORIZED", LOGGER.records[1]["reason"])
+}
+
+func TestWrap_Disable(t *testing.T) {
+	LOGGER := &recordLogger{}
+	mw := Wrap("check_auth", false, rejectMiddleware, LOGGER)
+	_, err := mw(handleFunc)(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Empty(t, LOGGER.records)
+}
@@ -0,0 +1,18 @@
+package ipkratos
+
+import (
+	"context"
+	"net"
+)
+
+type clientIPKey struct{}
+
+func SetClientIPIntoContext(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// GetClientIP 在 handler 里获取客户端 IP
+func GetClientIP(ctx context.Context) (net.IP, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(net.IP)
+	return ip, ok
+}
@@ -0,0 +1,216 @@
+package ipkratos
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+	"google.golang.org/grpc/peer"
+)
+
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	trustedHeaders    []string
+	trustedProxies    []*net.IPNet
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher) *Config {
+	return &Config{
+		selectPath:     selectPath,
+		trustedHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+		enable:         true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印取客户端 IP 的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithTrustedHeaders 设置读取客户端 IP 的请求头，按顺序优先，默认是 X-Forwarded-For 和 X-Real-IP
+func (a *Config) WithTrustedHeaders(headers ...string) *Config {
+	a.trustedHeaders = headers
+	return a
+}
+
+// WithTrustedProxyCIDRs 只有对端地址在这些网段里时才读取请求头，否则直接使用对端地址，格式错误时 panic
+// 没有设置时不读取请求头，总是使用对端地址，避免客户端伪造 X-Forwarded-For
+func (a *Config) WithTrustedProxyCIDRs(cidrs ...string) *Config {
+	a.trustedProxies = MustParseCIDRs(cidrs...)
+	return a
+}
+
+// MustParseCIDRs 解析网段列表，单独的 IP 当作只包含它自己的网段，格式错误时 panic
+func MustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var ipNets = make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			must.TRUE(ip != nil)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			ipNets = append(ipNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		must.Done(err)
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets
+}
+
+// ContainsIP 判断 IP 是否在任意一个网段里
+func ContainsIP(ipNets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new client_ip middleware enable=%v headers=%v proxies=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.trustedHeaders,
+		len(cfg.trustedProxies),
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("client_ip", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must extract client ip", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip extract client ip", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("client_ip: cfg.enable=false pass")
+				return handleFunc(ctx, req)
+			}
+			if ip, ok := cfg.extractIP(ctx); ok {
+				ctx = SetClientIPIntoContext(ctx, ip)
+			} else {
+				LOG.Debugf("client_ip: no valid client ip in request")
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
+
+// extractIP 对端是可信代理时按顺序读取请求头，都没有合法的 IP 时使用对端地址
+// 没有设置可信代理或者对端不是可信代理时，请求头可能是客户端伪造的，直接使用对端地址
+func (a *Config) extractIP(ctx context.Context) (net.IP, bool) {
+	peerIP, hasPeer := GetPeerIP(ctx)
+	if !hasPeer || !ContainsIP(a.trustedProxies, peerIP) {
+		return peerIP, hasPeer
+	}
+	if tp, ok := transport.FromServerContext(ctx); ok {
+		for _, header := range a.trustedHeaders {
+			if ip, ok := a.parseHeader(tp.RequestHeader().Get(header)); ok {
+				return ip, true
+			}
+		}
+	}
+	return peerIP, hasPeer
+}
+
+// parseHeader 解析 X-Forwarded-For 这种逗号分隔的值，格式是 "client, proxy1, proxy2"
+// 从右往左跳过可信代理，取第一个不可信的 IP，避免客户端伪造最左边的值，全部是可信代理时取最左边的 IP
+func (a *Config) parseHeader(value string) (net.IP, bool) {
+	if value == "" {
+		return nil, false
+	}
+	var ips []net.IP
+	for _, item := range strings.Split(value, ",") {
+		if ip := ParseIP(item); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, false
+	}
+	for idx := len(ips) - 1; idx >= 0; idx-- {
+		if !ContainsIP(a.trustedProxies, ips[idx]) {
+			return ips[idx], true
+		}
+	}
+	return ips[0], true
+}
+
+// ParseIP 解析单个 IP，兼容 "1.2.3.4:80"、"[::1]:80" 和带引号的写法，不合法时返回 nil
+func ParseIP(value string) net.IP {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+}
+
+// GetPeerIP 获取 TCP 对端的 IP，http 从 Request().RemoteAddr 读取，grpc 从 peer 信息读取
+func GetPeerIP(ctx context.Context) (net.IP, bool) {
+	var remoteAddr string
+	if tp, ok := transport.FromServerContext(ctx); ok {
+		if htp, ok := tp.(http.Transporter); ok && htp.Request() != nil {
+			remoteAddr = htp.Request().RemoteAddr
+		}
+	}
+	if remoteAddr == "" {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remoteAddr = p.Addr.String()
+		}
+	}
+	if ip := ParseIP(remoteAddr); ip != nil {
+		return ip, true
+	}
+	return nil, false
+}
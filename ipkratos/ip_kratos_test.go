@@ -0,0 +1,121 @@
+package ipkratos
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	ip, _ := GetClientIP(ctx)
+	return ip, nil
+}
+
+func callOnce(cfg *Config, tp *kratosmock.Transport) string {
+	res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		panic(err)
+	}
+	if ip := res.(net.IP); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func TestNewMiddleware(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithTrustedProxyCIDRs("192.0.2.1", "10.0.0.0/8")
+
+	testCases := []struct {
+		key    string
+		value  string
+		expect string
+	}{
+		{"X-Forwarded-For", "203.0.113.7", "203.0.113.7"},
+		{"X-Forwarded-For", "203.0.113.7, 10.0.0.1, 10.0.0.2", "203.0.113.7"},
+		{"X-Forwarded-For", "unknown, 203.0.113.7", "203.0.113.7"},
+		{"X-Forwarded-For", "203.0.113.7:8080", "203.0.113.7"},
+		{"X-Forwarded-For", `"[2001:db8::1]:443"`, "2001:db8::1"},
+		{"X-Forwarded-For", "2001:db8::1", "2001:db8::1"},
+		{"X-Real-IP", "198.51.100.2", "198.51.100.2"},
+		{"X-Real-IP", "not-ip", "192.0.2.1"},
+	}
+	for _, tc := range testCases {
+		tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000").WithHeader(tc.key, tc.value)
+		require.Equal(t, tc.expect, callOnce(cfg, tp), tc.value)
+	}
+
+	//X-Forwarded-For 优先于 X-Real-IP
+	tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000").WithHeader("X-Real-IP", "198.51.100.2").WithHeader("X-Forwarded-For", "203.0.113.7")
+	require.Equal(t, "203.0.113.7", callOnce(cfg, tp))
+
+	tp = kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[2001:db8::2]:5000")
+	require.Equal(t, "2001:db8::2", callOnce(cfg, tp))
+
+	tp = kratosmock.NewGRPCTransport("/a")
+	require.Empty(t, callOnce(cfg, tp))
+
+	tp = kratosmock.NewHTTPTransport("/a").WithHeader("X-Real-IP", "198.51.100.2")
+	require.Empty(t, callOnce(NewConfig(authkratosroutes.NewNone()), tp))
+}
+
+func TestNewMiddleware_SpoofedHeader(t *testing.T) {
+	//没有设置可信代理时忽略请求头，客户端不能伪造 IP
+	cfg := NewConfig(authkratosroutes.NewAll())
+	for _, key := range []string{"X-Forwarded-For", "X-Real-IP"} {
+		tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("198.51.100.9:5000").WithHeader(key, "10.0.0.1")
+		require.Equal(t, "198.51.100.9", callOnce(cfg, tp), key)
+	}
+	tp := kratosmock.NewHTTPTransport("/a").WithHeader("X-Forwarded-For", "10.0.0.1")
+	require.Empty(t, callOnce(cfg, tp))
+}
+
+func TestConfig_WithTrustedHeaders(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithTrustedHeaders("CF-Connecting-IP").WithTrustedProxyCIDRs("192.0.2.1")
+
+	tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000").WithHeader("CF-Connecting-IP", "203.0.113.7").WithHeader("X-Forwarded-For", "198.51.100.2")
+	require.Equal(t, "203.0.113.7", callOnce(cfg, tp))
+
+	tp = kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000").WithHeader("X-Forwarded-For", "198.51.100.2")
+	require.Equal(t, "192.0.2.1", callOnce(cfg, tp))
+}
+
+func TestConfig_WithTrustedProxyCIDRs(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithTrustedProxyCIDRs("10.0.0.0/8", "fd00::/8")
+
+	//对端是可信代理，从右往左跳过可信代理
+	tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("10.0.0.9:5000").WithHeader("X-Forwarded-For", "1.1.1.1, 203.0.113.7, 10.0.0.1")
+	require.Equal(t, "203.0.113.7", callOnce(cfg, tp))
+
+	tp = kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[fd00::9]:5000").WithHeader("X-Real-IP", "2001:db8::1")
+	require.Equal(t, "2001:db8::1", callOnce(cfg, tp))
+
+	//对端不是可信代理，忽略请求头
+	tp = kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000").WithHeader("X-Forwarded-For", "203.0.113.7")
+	require.Equal(t, "192.0.2.1", callOnce(cfg, tp))
+
+	require.Panics(t, func() {
+		NewConfig(authkratosroutes.NewAll()).WithTrustedProxyCIDRs("10.0.0.0/33")
+	})
+}
+
+func TestMustParseCIDRs(t *testing.T) {
+	ipNets := MustParseCIDRs("192.0.2.0/24", "203.0.113.7", "2001:db8::1")
+	require.True(t, ContainsIP(ipNets, net.ParseIP("192.0.2.200")))
+	require.True(t, ContainsIP(ipNets, net.ParseIP("203.0.113.7")))
+	require.False(t, ContainsIP(ipNets, net.ParseIP("203.0.113.8")))
+	require.True(t, ContainsIP(ipNets, net.ParseIP("2001:db8::1")))
+	require.False(t, ContainsIP(ipNets, net.ParseIP("2001:db8::2")))
+
+	require.Panics(t, func() {
+		MustParseCIDRs("not-ip")
+	})
+}
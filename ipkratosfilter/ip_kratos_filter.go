@@ -0,0 +1,136 @@
+package ipkratosfilter
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/orzkratos/authkratos/ipkratos"
+)
+
+type FilterMode string
+
+const (
+	ALLOW FilterMode = "ALLOW"
+	DENY  FilterMode = "DENY"
+)
+
+// Config 按客户端 IP 过滤请求，放在 ipkratos 中间件后面时使用它解析的客户端 IP，否则使用对端地址
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	filterMode        FilterMode
+	ipNets            []*net.IPNet
+	enable            bool
+	structuredLogging bool
+}
+
+// NewAllowConfig 只允许这些网段的 IP 访问，网段格式错误时 panic
+func NewAllowConfig(selectPath authkratosroutes.Matcher, allowedCIDRs ...string) *Config {
+	return &Config{
+		selectPath: selectPath,
+		filterMode: ALLOW,
+		ipNets:     ipkratos.MustParseCIDRs(allowedCIDRs...),
+		enable:     true,
+	}
+}
+
+// NewDenyConfig 禁止这些网段的 IP 访问，网段格式错误时 panic
+func NewDenyConfig(selectPath authkratosroutes.Matcher, blockedCIDRs ...string) *Config {
+	return &Config{
+		selectPath: selectPath,
+		filterMode: DENY,
+		ipNets:     ipkratos.MustParseCIDRs(blockedCIDRs...),
+		enable:     true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印 IP 过滤结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+func (a *Config) checkIP(ip net.IP) bool {
+	switch a.filterMode {
+	case ALLOW:
+		return ipkratos.ContainsIP(a.ipNets, ip)
+	case DENY:
+		return !ipkratos.ContainsIP(a.ipNets, ip)
+	default:
+		panic(a.filterMode)
+	}
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new ip_kratos_filter middleware enable=%v mode=%v cidrs=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.filterMode,
+		len(cfg.ipNets),
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("ip_kratos_filter", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must check ip", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip check ip", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("ip_kratos_filter: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			ip, ok := ipkratos.GetClientIP(ctx)
+			if !ok {
+				ip, ok = ipkratos.GetPeerIP(ctx)
+			}
+			if !ok {
+				return nil, errors.Unauthorized("UNAUTHORIZED", "ip_kratos_filter: client ip is missing")
+			}
+			if !cfg.checkIP(ip) {
+				LOG.Infof("ip_kratos_filter: ip:%v mode:%v not pass", ip, cfg.filterMode)
+				return nil, errors.Forbidden("FORBIDDEN", "ip_kratos_filter: client ip not allowed")
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
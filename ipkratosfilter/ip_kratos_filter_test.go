@@ -0,0 +1,83 @@
+package ipkratosfilter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/orzkratos/authkratos/ipkratos"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+func callOnce(mw middleware.Middleware, tp *kratosmock.Transport) error {
+	_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	return err
+}
+
+func TestNewAllowConfig(t *testing.T) {
+	mw := NewMiddleware(NewAllowConfig(authkratosroutes.NewAll(), "10.0.0.0/8", "2001:db8::/32"), log.DefaultLogger)
+
+	require.NoError(t, callOnce(mw, kratosmock.NewHTTPTransport("/a").WithRemoteAddr("10.1.2.3:5000")))
+	require.NoError(t, callOnce(mw, kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[2001:db8::1]:5000")))
+
+	erk := callOnce(mw, kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000"))
+	require.True(t, errors.IsForbidden(erk))
+	erk = callOnce(mw, kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[2001:db9::1]:5000"))
+	require.True(t, errors.IsForbidden(erk))
+
+	//取不到 IP 时返回未认证
+	erk = callOnce(mw, kratosmock.NewGRPCTransport("/a"))
+	require.True(t, errors.IsUnauthorized(erk))
+}
+
+func TestNewDenyConfig(t *testing.T) {
+	mw := NewMiddleware(NewDenyConfig(authkratosroutes.NewAll(), "192.0.2.0/24", "fd00::/8"), log.DefaultLogger)
+
+	require.NoError(t, callOnce(mw, kratosmock.NewHTTPTransport("/a").WithRemoteAddr("10.1.2.3:5000")))
+	require.NoError(t, callOnce(mw, kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[2001:db8::1]:5000")))
+
+	erk := callOnce(mw, kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000"))
+	require.True(t, errors.IsForbidden(erk))
+	erk = callOnce(mw, kratosmock.NewGRPCTransport("/a").WithRemoteAddr("[fd00::1]:5000"))
+	require.True(t, errors.IsForbidden(erk))
+}
+
+func TestNewMiddleware_WithClientIP(t *testing.T) {
+	//先经过 ipkratos 从请求头解析客户端 IP，再按客户端 IP 过滤
+	cfg := NewAllowConfig(authkratosroutes.NewAll(), "203.0.113.0/24")
+	mw := middleware.Chain(
+		ipkratos.NewMiddleware(ipkratos.NewConfig(authkratosroutes.NewAll()).WithTrustedProxyCIDRs("10.0.0.0/8"), log.DefaultLogger),
+		NewMiddleware(cfg, log.DefaultLogger),
+	)
+
+	tp := kratosmock.NewHTTPTransport("/a").WithRemoteAddr("10.0.0.1:5000").WithHeader("X-Forwarded-For", "203.0.113.7")
+	require.NoError(t, callOnce(mw, tp))
+
+	tp = kratosmock.NewHTTPTransport("/a").WithRemoteAddr("10.0.0.1:5000").WithHeader("X-Forwarded-For", "198.51.100.2")
+	require.True(t, errors.IsForbidden(callOnce(mw, tp)))
+
+	//不在可信代理网段的对端伪造请求头无效
+	tp = kratosmock.NewHTTPTransport("/a").WithRemoteAddr("198.51.100.9:5000").WithHeader("X-Forwarded-For", "203.0.113.7")
+	require.True(t, errors.IsForbidden(callOnce(mw, tp)))
+}
+
+func TestNewMiddleware_Skip(t *testing.T) {
+	cfg := NewAllowConfig(authkratosroutes.NewInclude("/a"), "10.0.0.0/8")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	require.NoError(t, callOnce(mw, kratosmock.NewHTTPTransport("/b").WithRemoteAddr("192.0.2.1:5000")))
+
+	cfg.SetEnable(false)
+	require.NoError(t, callOnce(mw, kratosmock.NewHTTPTransport("/a").WithRemoteAddr("192.0.2.1:5000")))
+}
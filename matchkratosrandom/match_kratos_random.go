@@ -0,0 +1,95 @@
+package matchkratosrandom
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+)
+
+type Config struct {
+	selectPath authkratosroutes.Matcher
+	matchRate  float64
+	enable     bool
+	randFloat  func() float64
+	opRates    map[authkratosroutes.Path]float64
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher, matchRate float64) *Config {
+	return &Config{
+		selectPath: selectPath,
+		matchRate:  matchRate,
+		enable:     true,
+		randFloat:  rand.Float64,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithRandSource 使用指定的随机数源，比如单测里使用 rand.NewSource(42) 让结果可以复现
+// rand.New 返回的对象不是并发安全的，因此这里加锁使用
+func (a *Config) WithRandSource(src rand.Source) *Config {
+	var mutex sync.Mutex
+	rnd := rand.New(src)
+	a.randFloat = func() float64 {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return rnd.Float64()
+	}
+	return a
+}
+
+// WithOperationRates 给单个接口设置单独的概率，没有设置的接口依然使用 matchRate，只对 selectPath 选中的接口生效
+func (a *Config) WithOperationRates(rates map[authkratosroutes.Path]float64) *Config {
+	a.opRates = rates
+	return a
+}
+
+func (a *Config) getRate(operation string) float64 {
+	if rate, ok := a.opRates[authkratosroutes.Path(operation)]; ok {
+		return rate
+	}
+	return a.matchRate
+}
+
+// NewMatchFunc 在 selectPath 选中的接口里再按概率选择是否执行中间件，比如设置0.3就是有30%的概率执行
+// 用法 selector.Server(mw).Match(NewMatchFunc(cfg, LOGGER)).Build() 比如只对部分请求打印详细日志
+func NewMatchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new match_random match_func enable=%v rate=%v operation_rates=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.matchRate,
+		len(cfg.opRates),
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		if !cfg.selectPath.Match(operation) {
+			LOG.Debugf("operation=%s include=%v match=false skip", operation, authkratosroutes.SideOf(cfg.selectPath))
+			return false
+		}
+		rate := cfg.getRate(operation)
+		match := cfg.randFloat() < rate
+		LOG.Debugf("operation=%s match_random rate=%v match=%v", operation, rate, match)
+		return match
+	}
+}
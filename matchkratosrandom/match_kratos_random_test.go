@@ -0,0 +1,81 @@
+package matchkratosrandom
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/matchkratosrandom/testutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestNewMatchFunc(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), 0.3)
+	matchFunc := NewMatchFunc(cfg, log.NewFilter(log.DefaultLogger, log.FilterLevel(log.LevelInfo)))
+
+	const n = 10000
+	matched, skipped := testutils.MustSampleN(matchFunc, "/a", n)
+	require.Equal(t, n, matched+skipped)
+	testutils.AssertApproximateRate(t, matched, n, 0.3, 0.05)
+
+	matched, _ = testutils.MustSampleN(matchFunc, "/b", n)
+	require.Equal(t, 0, matched)
+}
+
+func TestNewMatchFunc_Disable(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), 1)
+	cfg.SetEnable(false)
+	matchFunc := NewMatchFunc(cfg, log.DefaultLogger)
+
+	matched, _ := testutils.MustSampleN(matchFunc, "/a", 100)
+	require.Equal(t, 0, matched)
+}
+
+func TestConfig_WithRandSource(t *testing.T) {
+	newMatchFunc := func(seed int64) selector.MatchFunc {
+		cfg := NewConfig(authkratosroutes.NewInclude("/a"), 0.5).WithRandSource(rand.NewSource(seed))
+		return NewMatchFunc(cfg, log.NewFilter(log.DefaultLogger, log.FilterLevel(log.LevelInfo)))
+	}
+	sample := func(matchFunc selector.MatchFunc) []bool {
+		var results = make([]bool, 0, 100)
+		for idx := 0; idx < 100; idx++ {
+			results = append(results, matchFunc(context.Background(), "/a"))
+		}
+		return results
+	}
+
+	//相同的种子得到相同的序列
+	results := sample(newMatchFunc(42))
+	require.Equal(t, results, sample(newMatchFunc(42)))
+	require.Contains(t, results, true)
+	require.Contains(t, results, false)
+	require.NotEqual(t, results, sample(newMatchFunc(7)))
+}
+
+func TestConfig_WithOperationRates(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a", "/b", "/c"), 0.5).WithOperationRates(map[authkratosroutes.Path]float64{
+		"/a": 0.2,
+		"/b": 0.8,
+		"/x": 1,
+	})
+	matchFunc := NewMatchFunc(cfg, log.NewFilter(log.DefaultLogger, log.FilterLevel(log.LevelInfo)))
+
+	const n = 10000
+	matched, _ := testutils.MustSampleN(matchFunc, "/a", n)
+	testutils.AssertApproximateRate(t, matched, n, 0.2, 0.05)
+	matched, _ = testutils.MustSampleN(matchFunc, "/b", n)
+	testutils.AssertApproximateRate(t, matched, n, 0.8, 0.05)
+	matched, _ = testutils.MustSampleN(matchFunc, "/c", n)
+	testutils.AssertApproximateRate(t, matched, n, 0.5, 0.05)
+
+	//没有被 selectPath 选中的接口即使设置了概率也不匹配
+	matched, _ = testutils.MustSampleN(matchFunc, "/x", n)
+	require.Equal(t, 0, matched)
+}
@@ -0,0 +1,30 @@
+package testutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+)
+
+// MustSampleN 执行 n 次匹配函数，统计命中和跳过的次数，用于在单测里验证随机匹配的分布
+func MustSampleN(matchFunc selector.MatchFunc, operation string, n int) (matched, skipped int) {
+	must.TRUE(n > 0)
+	ctx := context.Background()
+	for idx := 0; idx < n; idx++ {
+		if matchFunc(ctx, operation) {
+			matched++
+		} else {
+			skipped++
+		}
+	}
+	return matched, skipped
+}
+
+// AssertApproximateRate 断言命中的比例约等于期望值，误差不超过 tolerance
+func AssertApproximateRate(t *testing.T, matched, n int, expected, tolerance float64) {
+	require.Greater(t, n, 0)
+	require.InDelta(t, expected, float64(matched)/float64(n), tolerance)
+}
@@ -0,0 +1,26 @@
+package testutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMustSampleN(t *testing.T) {
+	var count int
+	matchFunc := func(ctx context.Context, operation string) bool {
+		count++
+		return count%4 == 0
+	}
+	matched, skipped := MustSampleN(matchFunc, "/a", 100)
+	require.Equal(t, 25, matched)
+	require.Equal(t, 75, skipped)
+	AssertApproximateRate(t, matched, 100, 0.25, 0.0001)
+}
+
+func TestMustSampleN_Panic(t *testing.T) {
+	require.Panics(t, func() {
+		MustSampleN(func(ctx context.Context, operation string) bool { return true }, "/a", 0)
+	})
+}
@@ -4,18 +4,36 @@ import (
 	"context"
 	"math/rand"
 	"net/http"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos"
 	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
 )
 
 type Config struct {
-	rateMap map[authkratosroutes.Path]float64
-	rate    float64
-	enable  bool
+	rateMap           map[authkratosroutes.Path]float64
+	rate              float64
+	enable            bool
+	blockCode         int
+	blockReason       string
+	blockMessage      string
+	dryRun            bool
+	rampUp            *rampUp
+	nowFunc           func() time.Time
+	structuredLogging bool
+}
+
+// rampUp 默认通过率从 start 线性变化到 end，duration 以后保持 end
+type rampUp struct {
+	start    float64
+	end      float64
+	duration time.Duration
 }
 
 func NewConfig(
@@ -23,9 +41,13 @@ func NewConfig(
 	rate float64,
 ) *Config {
 	return &Config{
-		rateMap: rateMap,
-		rate:    rate,
-		enable:  true,
+		rateMap:      rateMap,
+		rate:         rate,
+		enable:       true,
+		blockCode:    http.StatusServiceUnavailable,
+		blockReason:  "RANDOM_RATE_NOT_PASS",
+		blockMessage: "random rate not pass",
+		nowFunc:      time.Now,
 	}
 }
 
@@ -40,47 +62,125 @@ func (a *Config) IsEnable() bool {
 	return false
 }
 
+// WithStructuredLogging 按请求打印是否随机放行的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithBlockError 设置拦截时返回的错误，默认是 503 RANDOM_RATE_NOT_PASS，比如可以改成 429 让客户端稍后重试
+func (a *Config) WithBlockError(code int, reason string, message string) *Config {
+	a.blockCode = code
+	a.blockReason = reason
+	a.blockMessage = message
+	return a
+}
+
+// WithOperationRates 给单个接口设置单独的通过率，和 NewConfig 的 rateMap 合并，相同的接口以这里的为准
+func (a *Config) WithOperationRates(rates map[authkratosroutes.Path]float64) *Config {
+	var rateMap = make(map[authkratosroutes.Path]float64, len(a.rateMap)+len(rates))
+	for path, rate := range a.rateMap {
+		rateMap[path] = rate
+	}
+	for path, rate := range rates {
+		rateMap[path] = rate
+	}
+	a.rateMap = rateMap
+	return a
+}
+
+// WithDryRun 设置为 true 时依然掷概率并打印会被拦截的日志，但是不拦截请求，便于上线前观察拦截的效果
+func (a *Config) WithDryRun(dryRun bool) *Config {
+	a.dryRun = dryRun
+	return a
+}
+
+// WithRampUp 让默认通过率在 duration 时长内从 start 线性变化到 end，之后保持 end，比如灰度发布时从 5% 逐渐放量到 100%
+// 从创建 NewMiddleware 或 NewMatchFunc 时开始计时，单独设置了通过率的接口不受影响
+func (a *Config) WithRampUp(start float64, end float64, duration time.Duration) *Config {
+	must.TRUE(duration > 0)
+	a.rampUp = &rampUp{start: start, end: end, duration: duration}
+	return a
+}
+
+// getRate 返回接口当前的通过率，elapsed 是从开始计时到现在的时长
+func (a *Config) getRate(operation string, elapsed time.Duration) float64 {
+	if r, ok := a.rateMap[authkratosroutes.New(operation)]; ok {
+		return r
+	}
+	if a.rampUp == nil {
+		return a.rate //没配置通过率的接口就是用这个默认的通过率
+	}
+	if elapsed >= a.rampUp.duration {
+		return a.rampUp.end
+	}
+	if elapsed <= 0 {
+		return a.rampUp.start
+	}
+	progress := float64(elapsed) / float64(a.rampUp.duration)
+	return a.rampUp.start + (a.rampUp.end-a.rampUp.start)*progress
+}
+
 // NewMiddleware 让接口有一定概率失败
 func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 	LOG.Infof(
-		"new rate_pass middleware enable=%v operations=%v rate=%v",
+		"new rate_pass middleware enable=%v operations=%v rate=%v ramp_up=%v dry_run=%v version=%v",
 		cfg.IsEnable(),
 		len(cfg.rateMap),
 		cfg.rate,
+		cfg.rampUp != nil,
+		cfg.dryRun,
+		authkratos.Version(),
 	)
 
-	return selector.Server(middlewareFunc()).Match(matchFunc(cfg, LOGGER)).Build()
+	return selector.Server(structlog.Wrap("rate_pass", cfg.structuredLogging, NewBlockingMiddleware(cfg, LOGGER), LOGGER)).Match(NewMatchFunc(cfg, LOGGER)).Build()
+}
+
+// NewBlockingMiddleware 只负责拦截，不负责选择路由和掷概率，哪些请求会被拦截完全由外部的 selector.MatchFunc 决定
+// 用法 selector.Server(NewBlockingMiddleware(cfg, LOGGER)).Match(matchFunc).Build() 这样能和其它路由规则自由组合
+func NewBlockingMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	return middlewareFunc(cfg, LOGGER)
 }
 
-func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+// NewMatchFunc 单独提供随机拦截的匹配函数，返回 true 表示这次请求需要被拦截
+// 即匹配的概率是 1-rate，和 matchkratosrandom 的匹配概率相反，配合 NewBlockingMiddleware 使用
+func NewMatchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 	LOG := log.NewHelper(LOGGER)
 
+	startTime := cfg.nowFunc()
+
 	return func(ctx context.Context, operation string) bool {
 		if !cfg.enable {
 			return false
 		}
-		if len(cfg.rateMap) > 0 {
-			path := authkratosroutes.New(operation)
-			if rate, ok := cfg.rateMap[path]; ok {
-				pass := rand.Float64() < rate //比如设置0.6就是有60%的概率通过
-				LOG.Debugf("operation=%s in rate_map rate_pass rate=%v pass=%v", operation, rate, pass)
-				return !pass
-			}
+		rate := cfg.getRate(operation, cfg.nowFunc().Sub(startTime))
+		roll := rand.Float64()
+		pass := roll < rate //比如设置0.6就是有60%的概率通过
+		LOG.Debugf("operation=%s rate_pass rate=%v pass=%v", operation, rate, pass)
+		if cfg.dryRun && !pass {
+			LOG.Infof("operation=%s rate_pass dry_run roll=%v rate=%v would block", operation, roll, rate)
 		}
-		//这里不是else，而是默认的，就是没配置通过率的，就是用这个默认的通过率
-		pass := rand.Float64() < cfg.rate //设置0.6就是有60%的概率通过
-		LOG.Debugf("operation=%s rate_pass rate=%v pass=%v", operation, cfg.rate, pass)
 		return !pass //当不通过时才执行 middlewareFunc
 	}
 }
 
-func middlewareFunc() middleware.Middleware {
-	erk := errors.New(http.StatusServiceUnavailable, "RANDOM_RATE_NOT_PASS", "random rate not pass")
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	erk := errors.New(cfg.blockCode, cfg.blockReason, cfg.blockMessage)
 
 	//当已经命中概率的时候，就直接返回错误
 	return func(handleFunc middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("rate_pass: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if cfg.dryRun {
+				LOG.Debugf("rate_pass: dry_run would block so pass")
+				return handleFunc(ctx, req)
+			}
 			return nil, erk
 		}
 	}
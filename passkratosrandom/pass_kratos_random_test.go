@@ -1,9 +1,157 @@
 package passkratosrandom
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/orzkratos/authkratos/matchkratosrandom"
+	"github.com/orzkratos/authkratos/matchkratosrandom/testutils"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
 	m.Run()
 }
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+func callOnce(mw middleware.Middleware, operation string) error {
+	ctx := kratosmock.NewHTTPTransport(operation).NewContext(context.Background())
+	_, err := mw(handleFunc)(ctx, nil)
+	return err
+}
+
+func TestNewBlockingMiddleware(t *testing.T) {
+	newConfigs := []func() *Config{
+		func() *Config { return NewConfig(nil, 0) },
+		func() *Config { return NewConfig(nil, 1) },
+		func() *Config {
+			return NewConfig(map[authkratosroutes.Path]float64{"/a": 1, "/b": 0}, 0)
+		},
+		func() *Config {
+			cfg := NewConfig(nil, 0)
+			cfg.SetEnable(false)
+			return cfg
+		},
+	}
+	for _, newConfig := range newConfigs {
+		cfg := newConfig()
+		combined := NewMiddleware(cfg, log.DefaultLogger)
+		decoupled := selector.Server(NewBlockingMiddleware(cfg, log.DefaultLogger)).Match(NewMatchFunc(cfg, log.DefaultLogger)).Build()
+
+		for _, operation := range []string{"/a", "/b", "/c"} {
+			erk1 := callOnce(combined, operation)
+			erk2 := callOnce(decoupled, operation)
+			require.Equal(t, erk1 == nil, erk2 == nil, operation)
+		}
+	}
+}
+
+func TestNewBlockingMiddleware_AlwaysBlock(t *testing.T) {
+	cfg := NewConfig(nil, 1)
+	mw := selector.Server(NewBlockingMiddleware(cfg, log.DefaultLogger)).Path("/a").Build()
+
+	require.Error(t, callOnce(mw, "/a"))
+	require.NoError(t, callOnce(mw, "/b"))
+}
+
+func TestNewMatchFunc(t *testing.T) {
+	LOGGER := log.NewFilter(log.DefaultLogger, log.FilterLevel(log.LevelInfo))
+
+	const n = 10000
+	blockFunc := NewMatchFunc(NewConfig(nil, 0.7), LOGGER)
+	blocked, passed := testutils.MustSampleN(blockFunc, "/a", n)
+	require.Equal(t, n, blocked+passed)
+	testutils.AssertApproximateRate(t, blocked, n, 0.3, 0.05)
+
+	matchFunc := matchkratosrandom.NewMatchFunc(matchkratosrandom.NewConfig(authkratosroutes.NewExclude(), 1-0.7), LOGGER)
+	matched, _ := testutils.MustSampleN(matchFunc, "/a", n)
+	require.InDelta(t, float64(matched)/n, float64(blocked)/n, 0.05)
+}
+
+func TestConfig_WithBlockError(t *testing.T) {
+	erk := errors.FromError(callOnce(NewMiddleware(NewConfig(nil, 0), log.DefaultLogger), "/a"))
+	require.Equal(t, int32(http.StatusServiceUnavailable), erk.Code)
+	require.Equal(t, "RANDOM_RATE_NOT_PASS", erk.Reason)
+
+	cfg := NewConfig(nil, 0).WithBlockError(http.StatusTooManyRequests, "TRY_AGAIN_LATER", "please try again later")
+	erk = errors.FromError(callOnce(NewMiddleware(cfg, log.DefaultLogger), "/a"))
+	require.Equal(t, int32(http.StatusTooManyRequests), erk.Code)
+	require.Equal(t, "TRY_AGAIN_LATER", erk.Reason)
+	require.Equal(t, "please try again later", erk.Message)
+}
+
+func TestConfig_WithOperationRates(t *testing.T) {
+	cfg := NewConfig(map[authkratosroutes.Path]float64{"/a": 0, "/c": 0}, 0).
+		WithOperationRates(map[authkratosroutes.Path]float64{"/a": 1, "/b": 0.5}).
+		WithBlockError(http.StatusTooManyRequests, "TRY_AGAIN_LATER", "please try again later")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	var blocked int
+	for idx := 0; idx < 1000; idx++ {
+		require.NoError(t, callOnce(mw, "/a"))
+		if erk := callOnce(mw, "/b"); erk != nil {
+			require.Equal(t, "TRY_AGAIN_LATER", errors.Reason(erk))
+			blocked++
+		}
+		require.Error(t, callOnce(mw, "/c"))
+	}
+	require.InDelta(t, 500, blocked, 100)
+}
+
+func TestConfig_WithDryRun(t *testing.T) {
+	cfg := NewConfig(map[authkratosroutes.Path]float64{"/b": 0}, 0).WithDryRun(true)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	decoupled := selector.Server(NewBlockingMiddleware(cfg, log.DefaultLogger)).Match(NewMatchFunc(cfg, log.DefaultLogger)).Build()
+
+	for idx := 0; idx < 100; idx++ {
+		for _, operation := range []string{"/a", "/b"} {
+			require.NoError(t, callOnce(mw, operation))
+			require.NoError(t, callOnce(decoupled, operation))
+		}
+	}
+
+	require.Error(t, callOnce(NewMiddleware(cfg.WithDryRun(false), log.DefaultLogger), "/a"))
+}
+
+func TestConfig_WithRampUp(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := NewConfig(map[authkratosroutes.Path]float64{"/b": 0}, 0).WithRampUp(0, 1, 30*time.Minute)
+	cfg.nowFunc = func() time.Time { return now }
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	require.Equal(t, 0.0, cfg.getRate("/a", 0))
+	require.Equal(t, 0.5, cfg.getRate("/a", 15*time.Minute))
+	require.Equal(t, 1.0, cfg.getRate("/a", 30*time.Minute))
+	require.Equal(t, 1.0, cfg.getRate("/a", time.Hour))
+	require.Equal(t, 0.0, cfg.getRate("/b", time.Hour))
+
+	for idx := 0; idx < 100; idx++ {
+		require.Error(t, callOnce(mw, "/a"))
+	}
+
+	now = now.Add(15 * time.Minute)
+	var blocked int
+	for idx := 0; idx < 1000; idx++ {
+		if callOnce(mw, "/a") != nil {
+			blocked++
+		}
+	}
+	require.InDelta(t, 500, blocked, 100)
+
+	now = now.Add(time.Hour)
+	for idx := 0; idx < 100; idx++ {
+		require.NoError(t, callOnce(mw, "/a"))
+		require.Error(t, callOnce(mw, "/b"))
+	}
+}
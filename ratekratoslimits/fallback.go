@@ -0,0 +1,16 @@
+package utils_kratos_ratelimit
+
+// RateLimitFallback 访问 redis 出错时的处理方式
+type RateLimitFallback string
+
+const (
+	FallbackDeny  RateLimitFallback = "DENY"  //默认的处理方式，返回错误，即 redis 不可用时拒绝请求
+	FallbackAllow RateLimitFallback = "ALLOW" //打印警告日志并放行，即 redis 不可用时不限流
+)
+
+// WithFallbackOnRedisError 设置访问 redis 出错时的处理方式，默认是 FallbackDeny
+// 对可用性要求比限流更高的服务可以使用 FallbackAllow
+func (a *Config) WithFallbackOnRedisError(fallback RateLimitFallback) *Config {
+	a.fallback = fallback
+	return a
+}
@@ -0,0 +1,39 @@
+package utils_kratos_ratelimit
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithFallbackOnRedisError(t *testing.T) {
+	mrd := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mrd.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	rule := redis_rate.PerMinute(2)
+	denyCfg := NewRedisConfig(redis_rate.NewLimiter(rdb), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a"))
+	allowCfg := NewRedisConfig(redis_rate.NewLimiter(rdb), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithFallbackOnRedisError(FallbackAllow)
+	denyMw := NewMiddleware(denyCfg, log.DefaultLogger)
+	allowMw := NewMiddleware(allowCfg, log.DefaultLogger)
+
+	_, err := callAsUser(denyMw, "/a", "alice")
+	require.NoError(t, err)
+
+	//redis 不可用
+	mrd.Close()
+
+	_, err = callAsUser(denyMw, "/a", "alice")
+	require.Error(t, err)
+
+	for idx := 0; idx < 5; idx++ {
+		_, err = callAsUser(allowMw, "/a", "alice")
+		require.NoError(t, err)
+	}
+}
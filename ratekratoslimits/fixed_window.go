@@ -0,0 +1,70 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/redis/go-redis/v9"
+	"github.com/yyle88/erero"
+)
+
+// RateLimitAlgorithm 限流算法
+type RateLimitAlgorithm string
+
+const (
+	AlgorithmGCRA        RateLimitAlgorithm = "GCRA"         //默认的算法，使用 redis_rate 的 GCRA 算法，请求均匀地通过
+	AlgorithmFixedWindow RateLimitAlgorithm = "FIXED_WINDOW" //固定窗口计数，每个 Period 窗口内最多通过 Rate 个请求，便于按配额计费
+)
+
+const fixedWindowPrefix = "rate_fixed"
+
+// WithAlgorithm 设置限流算法，默认是 AlgorithmGCRA
+// 使用 AlgorithmFixedWindow 时需要用 WithRedisClient 设置 redis 客户端，因为 redis_rate.Limiter 不暴露客户端
+// NewLocalConfig 创建的配置总是使用令牌桶，不受这个选项影响
+func (a *Config) WithAlgorithm(algo RateLimitAlgorithm) *Config {
+	a.algorithm = algo
+	return a
+}
+
+// WithRedisClient 设置固定窗口算法使用的 redis 客户端，通常和创建 Limiter 的客户端相同
+func (a *Config) WithRedisClient(rdb redis.UniversalClient) *Config {
+	a.redisClient = rdb
+	return a
+}
+
+// allowFixedWindow 在 {prefix}:{key}:{window_start_unix} 上计数，窗口结束后 key 自动过期
+func (a *Config) allowFixedWindow(ctx context.Context, key string, limit redis_rate.Limit) (*redis_rate.Result, error) {
+	now := time.Now()
+	windowStart := now.Truncate(limit.Period)
+	windowKey := fmt.Sprintf("%s:%s:%d", fixedWindowPrefix, key, windowStart.Unix())
+
+	var incr *redis.IntCmd
+	if _, err := a.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, windowKey)
+		pipe.Expire(ctx, windowKey, limit.Period)
+		return nil
+	}); err != nil {
+		return nil, erero.WithMessage(err, "rate_limit fixed window redis exception")
+	}
+
+	count := int(incr.Val())
+	resetAfter := windowStart.Add(limit.Period).Sub(now)
+	if count > limit.Rate {
+		return &redis_rate.Result{
+			Limit:      limit,
+			Allowed:    0,
+			Remaining:  0,
+			RetryAfter: resetAfter,
+			ResetAfter: resetAfter,
+		}, nil
+	}
+	return &redis_rate.Result{
+		Limit:      limit,
+		Allowed:    1,
+		Remaining:  limit.Rate - count,
+		RetryAfter: -1,
+		ResetAfter: resetAfter,
+	}, nil
+}
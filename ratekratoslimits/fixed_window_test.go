@@ -0,0 +1,54 @@
+package utils_kratos_ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/ratelimit"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithAlgorithm(t *testing.T) {
+	mrd := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mrd.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	rule := redis_rate.PerSecond(3)
+	cfg := NewRedisConfig(redis_rate.NewLimiter(rdb), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithAlgorithm(AlgorithmFixedWindow).
+		WithRedisClient(rdb)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//等到下个窗口开始，避免窗口在测试中途切换
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	for round := 0; round < 2; round++ {
+		for idx := 0; idx < 3; idx++ {
+			_, err := callAsUser(mw, "/a", "alice")
+			require.NoError(t, err)
+		}
+		_, err := callAsUser(mw, "/a", "alice")
+		require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+		//下个窗口重新获得完整的额度
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	}
+	require.NotEmpty(t, mrd.Keys())
+	for _, key := range mrd.Keys() {
+		require.Regexp(t, `^rate_fixed:alice:\d+$`, key)
+	}
+}
+
+func TestConfig_WithAlgorithm_NoClient(t *testing.T) {
+	rule := redis_rate.PerSecond(3)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithAlgorithm(AlgorithmFixedWindow)
+	require.Panics(t, func() {
+		NewMiddleware(cfg, log.DefaultLogger)
+	})
+}
@@ -0,0 +1,78 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/yyle88/must"
+	"golang.org/x/time/rate"
+)
+
+// NewLocalConfig 创建使用进程内存限流的配置，不依赖 redis，适合单测或者单实例部署
+// 每个 key 单独使用一个令牌桶，每 period 时长内最多通过 limit 个请求
+// 多个服务实例之间不共享额度，而且 key 不会被清理，因此 key 的数量需要可控
+func NewLocalConfig(
+	selectPath authkratosroutes.Matcher,
+	limit int,
+	period time.Duration,
+	parseUniqueCode func(ctx context.Context) string,
+) *Config {
+	must.TRUE(limit > 0)
+	must.TRUE(period > 0)
+	cfg := &Config{
+		parseUniqueCode: parseUniqueCode,
+		selectPath:      selectPath,
+		enable:          true,
+		localLimiter:    &localLimiter{buckets: map[string]*rate.Limiter{}},
+		algorithm:       AlgorithmGCRA,
+		fallback:        FallbackDeny,
+	}
+	cfg.SetLimit(&redis_rate.Limit{Rate: limit, Burst: limit, Period: period})
+	return cfg
+}
+
+type localLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// allow 消耗一个令牌，返回和 redis_rate 相同格式的结果，这样中间件的逻辑不用区分两种实现
+// 每次都按 rule 更新令牌桶，因此 SetLimit 在运行时修改规则也能生效
+func (l *localLimiter) allow(key string, rule redis_rate.Limit) *redis_rate.Result {
+	every := rate.Every(rule.Period / time.Duration(rule.Rate))
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = rate.NewLimiter(every, rule.Burst)
+		l.buckets[key] = bucket
+	} else if bucket.Limit() != every || bucket.Burst() != rule.Burst {
+		bucket.SetLimitAt(now, every)
+		bucket.SetBurstAt(now, rule.Burst)
+	}
+
+	reservation := bucket.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
+		return &redis_rate.Result{
+			Limit:      rule,
+			Allowed:    0,
+			Remaining:  0,
+			RetryAfter: delay,
+			ResetAfter: delay,
+		}
+	}
+	return &redis_rate.Result{
+		Limit:      rule,
+		Allowed:    1,
+		Remaining:  int(bucket.TokensAt(now)),
+		RetryAfter: -1,
+		ResetAfter: time.Duration(float64(rule.Burst)-bucket.TokensAt(now)) * (rule.Period / time.Duration(rule.Rate)),
+	}
+}
@@ -0,0 +1,72 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware/ratelimit"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLocalConfig(t *testing.T) {
+	var resetAfters []time.Duration
+	cfg := NewLocalConfig(authkratosroutes.NewInclude("/a"), 2, time.Minute, parseUniqueCode).
+		WithRetryAfterCallback(func(ctx context.Context, resetAfter time.Duration) {
+			resetAfters = append(resetAfters, resetAfter)
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+	_, err := callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+	require.Len(t, resetAfters, 1)
+	require.Positive(t, resetAfters[0])
+
+	_, err = callAsUser(mw, "/a", "bob")
+	require.NoError(t, err)
+	_, err = callAsUser(mw, "/b", "alice")
+	require.NoError(t, err)
+}
+
+func TestNewLocalConfig_Refill(t *testing.T) {
+	cfg := NewLocalConfig(authkratosroutes.NewInclude("/a"), 1, 50*time.Millisecond, parseUniqueCode)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, err := callAsUser(mw, "/a", "alice")
+	require.NoError(t, err)
+	_, err = callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = callAsUser(mw, "/a", "alice")
+	require.NoError(t, err)
+}
+
+func TestNewLocalConfig_SetLimit(t *testing.T) {
+	cfg := NewLocalConfig(authkratosroutes.NewInclude("/a"), 1, time.Minute, parseUniqueCode)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	_, err := callAsUser(mw, "/a", "alice")
+	require.NoError(t, err)
+	_, err = callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	loosen := redis_rate.PerSecond(1000)
+	cfg.SetLimit(&loosen)
+	for idx := 0; idx < 100; idx++ {
+		_, err = callAsUser(mw, "/a", "bob")
+		require.NoError(t, err)
+	}
+	//已有的令牌桶在下次请求时切换到新规则，之后按新的速率恢复
+	_, _ = callAsUser(mw, "/a", "alice")
+	time.Sleep(10 * time.Millisecond)
+	_, err = callAsUser(mw, "/a", "alice")
+	require.NoError(t, err)
+}
@@ -2,37 +2,105 @@ package utils_kratos_ratelimit
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/ratelimit"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
 	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos"
 	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/metrics"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
 )
 
 type Config struct {
-	rateLimitBottle *redis_rate.Limiter
-	rule            *redis_rate.Limit
-	parseUniqueCode func(ctx context.Context) string
-	selectPath      *authkratosroutes.SelectPath
-	enable          bool
+	rateLimitBottle   *redis_rate.Limiter
+	rule              atomic.Pointer[redis_rate.Limit]
+	parseUniqueCode   func(ctx context.Context) string
+	selectPath        authkratosroutes.Matcher
+	enable            bool
+	retryAfterFunc    func(ctx context.Context, resetAfter time.Duration)
+	readOnlyClient    redis.UniversalClient
+	localLimiter      *localLimiter
+	operationLimits   map[authkratosroutes.Path]*redis_rate.Limit
+	algorithm         RateLimitAlgorithm
+	redisClient       redis.UniversalClient
+	metrics           *metrics.Metrics
+	dryRun            bool
+	allowList         map[string]bool
+	fallback          RateLimitFallback
+	retryAfterHeader  bool
+	structuredLogging bool
 }
 
+// NewConfig 创建使用 redis 限流的配置
+//
+// Deprecated: 使用 NewRedisConfig 代替，名称更明确，参数和逻辑都相同
 func NewConfig(
 	rateLimitBottle *redis_rate.Limiter,
 	rule *redis_rate.Limit,
 	parseUniqueCode func(ctx context.Context) string,
-	selectPath *authkratosroutes.SelectPath,
+	selectPath authkratosroutes.Matcher,
 ) *Config {
-	return &Config{
+	return NewRedisConfig(rateLimitBottle, rule, parseUniqueCode, selectPath)
+}
+
+// NewRedisConfig 创建使用 redis 限流的配置，多个服务实例共享同一个限流额度
+func NewRedisConfig(
+	rateLimitBottle *redis_rate.Limiter,
+	rule *redis_rate.Limit,
+	parseUniqueCode func(ctx context.Context) string,
+	selectPath authkratosroutes.Matcher,
+) *Config {
+	cfg := &Config{
 		rateLimitBottle: rateLimitBottle,
-		rule:            rule,
 		parseUniqueCode: parseUniqueCode,
 		selectPath:      selectPath,
 		enable:          true,
+		algorithm:       AlgorithmGCRA,
+		fallback:        FallbackDeny,
+	}
+	cfg.SetLimit(rule)
+	return cfg
+}
+
+// SetLimit 运行时修改限流规则，修改以后后续的请求立即使用新规则，不需要重启服务
+func (a *Config) SetLimit(rule *redis_rate.Limit) {
+	a.rule.Store(rule)
+}
+
+func (a *Config) GetLimit() *redis_rate.Limit {
+	return a.rule.Load()
+}
+
+// WithOperationLimit 给单个接口设置单独的限流规则，覆盖默认规则，没有设置的接口依然使用默认规则
+// 设置单独规则的接口使用单独的限流额度，key 是 operation + ":" + parseUniqueCode 的结果，不和其它接口共享
+func (a *Config) WithOperationLimit(operation authkratosroutes.Path, limit *redis_rate.Limit) *Config {
+	must.Nice(limit)
+	if a.operationLimits == nil {
+		a.operationLimits = map[authkratosroutes.Path]*redis_rate.Limit{}
+	}
+	a.operationLimits[operation] = limit
+	return a
+}
+
+func (a *Config) getOperationLimit(ctx context.Context, uck string) (string, *redis_rate.Limit) {
+	if len(a.operationLimits) > 0 {
+		if tp, ok := transport.FromServerContext(ctx); ok {
+			if limit, ok := a.operationLimits[authkratosroutes.Path(tp.Operation())]; ok {
+				return tp.Operation() + ":" + uck, limit
+			}
+		}
 	}
+	return uck, a.GetLimit()
 }
 
 func (a *Config) SetEnable(enable bool) {
@@ -46,17 +114,72 @@ func (a *Config) IsEnable() bool {
 	return false
 }
 
+// WithStructuredLogging 按请求打印是否被限流的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithRetryAfterCallback 被限流时回调，参数是 redis_rate.Result 的 ResetAfter
+// 可以在回调里设置响应头，或者记录指标，让调用方知道多久以后可以重试
+func (a *Config) WithRetryAfterCallback(fn func(ctx context.Context, resetAfter time.Duration)) *Config {
+	a.retryAfterFunc = fn
+	return a
+}
+
+// WithMetrics 统计限流结果到 authkratos_rate_limit_requests_total{operation,result} 指标，result 是 allowed 或 rejected
+// 被限流时还会统计到 authkratos_rate_limit_rejections_total{operation} 指标
+func (a *Config) WithMetrics(reg prometheus.Registerer) *Config {
+	a.metrics = metrics.New(reg)
+	return a
+}
+
+// WithDryRun 设置为 true 时依然消耗限流额度并打印会被限流的日志，但是不拒绝请求，便于上线前观察限流的效果
+// 这时也不调用 WithRetryAfterCallback 设置的回调
+func (a *Config) WithDryRun(dryRun bool) *Config {
+	a.dryRun = dryRun
+	return a
+}
+
+// WithAllowList 这些 key 不限流，也不访问 redis，比如内部服务调用，key 是 parseUniqueCode 的结果，可以多次调用累加
+func (a *Config) WithAllowList(keys ...string) *Config {
+	if a.allowList == nil {
+		a.allowList = make(map[string]bool, len(keys))
+	}
+	for _, key := range keys {
+		a.allowList[key] = true
+	}
+	return a
+}
+
+func (a *Config) allow(ctx context.Context, uck string) (*redis_rate.Result, error) {
+	key, limit := a.getOperationLimit(ctx, uck)
+	if a.localLimiter != nil {
+		return a.localLimiter.allow(key, *limit), nil
+	}
+	if a.algorithm == AlgorithmFixedWindow {
+		return a.allowFixedWindow(ctx, key, *limit)
+	}
+	return a.rateLimitBottle.Allow(ctx, key, *limit)
+}
+
 func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 	LOG.Infof(
-		"new rate_limit middleware enable=%v rule=%v include=%v operations=%v",
+		"new rate_limit middleware enable=%v rule=%v algorithm=%v dry_run=%v include=%v operations=%v version=%v",
 		cfg.IsEnable(),
-		cfg.rule.String(),
-		cfg.selectPath.SelectSide,
-		len(cfg.selectPath.Operations),
+		cfg.GetLimit().String(),
+		cfg.algorithm,
+		cfg.dryRun,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
 	)
+	if cfg.algorithm == AlgorithmFixedWindow && cfg.localLimiter == nil {
+		must.Full(cfg.redisClient)
+	}
 
-	return selector.Server(middlewareFunc(cfg, LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+	return selector.Server(structlog.Wrap("rate_limit", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
 }
 
 func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
@@ -68,9 +191,9 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 		}
 		match := cfg.selectPath.Match(operation)
 		if match {
-			LOG.Debugf("operation=%s include=%v match=%v must check rate", operation, cfg.selectPath.SelectSide, match)
+			LOG.Debugf("operation=%s include=%v match=%v must check rate", operation, authkratosroutes.SideOf(cfg.selectPath), match)
 		} else {
-			LOG.Debugf("operation=%s include=%v match=%v skip check rate", operation, cfg.selectPath.SelectSide, match)
+			LOG.Debugf("operation=%s include=%v match=%v skip check rate", operation, authkratosroutes.SideOf(cfg.selectPath), match)
 		}
 		return match
 	}
@@ -79,8 +202,6 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 	LOG := log.NewHelper(LOGGER)
 
-	rateLimitRule := *cfg.rule
-
 	return func(handleFunc middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (resp interface{}, err error) {
 			if !cfg.IsEnable() {
@@ -89,17 +210,42 @@ func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
 			}
 
 			uck := cfg.parseUniqueCode(ctx)
+			if cfg.allowList[uck] {
+				LOG.Debugf("rate_limit key=%s in allow list so can pass", uck)
+				return handleFunc(ctx, req)
+			}
 
-			rls, err := cfg.rateLimitBottle.Allow(ctx, uck, rateLimitRule)
+			rls, err := cfg.allow(ctx, uck)
 			if err != nil {
+				if cfg.fallback == FallbackAllow {
+					LOG.Warnf("rate_limit redis exception so fallback pass err=%v", err)
+					return handleFunc(ctx, req)
+				}
 				return nil, erero.WithMessage(err, "rate_limit redis exception")
 			}
 
+			var operation string
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				operation = tp.Operation()
+			}
 			if rls.Allowed != 0 {
 				LOG.Debugf("rate_limit allowed=%v remaining=%v so can pass", rls.Allowed, rls.Remaining)
+				cfg.metrics.IncRateLimitRequest(operation, metrics.ResultAllowed)
 			} else {
+				cfg.metrics.IncRateLimitRequest(operation, metrics.ResultRejected)
+				if cfg.dryRun {
+					LOG.Warnf("rate_limit dry_run key=%s allowed=%v remaining=%v exceeds but still pass", uck, rls.Allowed, rls.Remaining)
+					return handleFunc(ctx, req)
+				}
 				LOG.Warnf("rate_limit exceeds so reject requests")
 
+				if cfg.retryAfterHeader {
+					setRetryAfterHeader(ctx, rls.ResetAfter)
+				}
+				if cfg.retryAfterFunc != nil {
+					cfg.retryAfterFunc(ctx, rls.ResetAfter)
+				}
+
 				return nil, ratelimit.ErrLimitExceed
 			}
 			return handleFunc(ctx, req)
@@ -1,9 +1,221 @@
 package utils_kratos_ratelimit
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/ratelimit"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
 	m.Run()
 }
+
+func newRateLimitBottle(t *testing.T) *redis_rate.Limiter {
+	mrd := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mrd.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return redis_rate.NewLimiter(rdb)
+}
+
+func parseUniqueCode(ctx context.Context) string {
+	if tp, ok := transport.FromServerContext(ctx); ok {
+		return tp.RequestHeader().Get("X-User")
+	}
+	return ""
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+func callAsUser(mw middleware.Middleware, operation string, username string) (*kratosmock.Transport, error) {
+	tp := kratosmock.NewHTTPTransport(operation).WithHeader("X-User", username)
+	_, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+	return tp, err
+}
+
+func TestNewMiddleware(t *testing.T) {
+	rule := redis_rate.PerMinute(2)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a"))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+	_, err := callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	_, err = callAsUser(mw, "/a", "bob")
+	require.NoError(t, err)
+	_, err = callAsUser(mw, "/b", "alice")
+	require.NoError(t, err)
+}
+
+func TestConfig_WithRetryAfterCallback(t *testing.T) {
+	var resetAfters []time.Duration
+	rule := redis_rate.PerMinute(1)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithRetryAfterCallback(func(ctx context.Context, resetAfter time.Duration) {
+			resetAfters = append(resetAfters, resetAfter)
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				tp.ReplyHeader().Set("Retry-After", resetAfter.String())
+			}
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	tp, err := callAsUser(mw, "/a", "alice")
+	require.NoError(t, err)
+	require.Empty(t, resetAfters)
+	require.Empty(t, tp.ReplyHeader().Get("Retry-After"))
+
+	tp, err = callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+	require.Len(t, resetAfters, 1)
+	require.Positive(t, resetAfters[0])
+	require.Equal(t, resetAfters[0].String(), tp.ReplyHeader().Get("Retry-After"))
+}
+
+func TestConfig_SetLimit(t *testing.T) {
+	rule := redis_rate.PerSecond(10)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a"))
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 5; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+
+	tighten := redis_rate.PerSecond(2)
+	cfg.SetLimit(&tighten)
+	require.Equal(t, tighten.String(), cfg.GetLimit().String())
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := callAsUser(mw, "/a", "bob")
+		require.NoError(t, err)
+	}
+	_, err := callAsUser(mw, "/a", "bob")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	var rejected bool
+	for idx := 0; idx < 3 && !rejected; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		rejected = err != nil
+	}
+	require.True(t, rejected)
+}
+
+func TestConfig_WithOperationLimit(t *testing.T) {
+	rule := redis_rate.PerMinute(3)
+	create := redis_rate.PerMinute(2)
+	update := redis_rate.PerMinute(1)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/create", "/update", "/other")).
+		WithOperationLimit("/create", &create).
+		WithOperationLimit("/update", &update)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 2; idx++ {
+		_, err := callAsUser(mw, "/create", "alice")
+		require.NoError(t, err)
+	}
+	_, err := callAsUser(mw, "/create", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	_, err = callAsUser(mw, "/update", "alice")
+	require.NoError(t, err)
+	_, err = callAsUser(mw, "/update", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+
+	//没有单独规则的接口使用默认规则
+	for idx := 0; idx < 3; idx++ {
+		_, err := callAsUser(mw, "/other", "alice")
+		require.NoError(t, err)
+	}
+	_, err = callAsUser(mw, "/other", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+}
+
+func TestConfig_WithMetrics(t *testing.T) {
+	rule := redis_rate.PerMinute(2)
+	reg := prometheus.NewRegistry()
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).WithMetrics(reg)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 5; idx++ {
+		_, _ = callAsUser(mw, "/a", "alice")
+	}
+	_, err := callAsUser(mw, "/a", "bob")
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP authkratos_rate_limit_requests_total Total number of requests checked by authkratos rate limit middlewares.
+# TYPE authkratos_rate_limit_requests_total counter
+authkratos_rate_limit_requests_total{operation="/a",result="allowed"} 3
+authkratos_rate_limit_requests_total{operation="/a",result="rejected"} 3
+# HELP authkratos_rate_limit_rejections_total Total number of requests rejected by authkratos rate limit middlewares.
+# TYPE authkratos_rate_limit_rejections_total counter
+authkratos_rate_limit_rejections_total{operation="/a"} 3
+`), "authkratos_rate_limit_requests_total", "authkratos_rate_limit_rejections_total"))
+	//限流结果不写到认证的指标里
+	count, err := testutil.GatherAndCount(reg, "authkratos_auth_requests_total")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestConfig_WithDryRun(t *testing.T) {
+	rule := redis_rate.PerMinute(2)
+	var callbacks int
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithDryRun(true).
+		WithRetryAfterCallback(func(ctx context.Context, resetAfter time.Duration) {
+			callbacks++
+		})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//超过限流额度的请求依然通过
+	for idx := 0; idx < 5; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 0, callbacks)
+
+	//额度确实被消耗了，关闭 dry-run 后立即被限流
+	_, err := callAsUser(NewMiddleware(cfg.WithDryRun(false), log.DefaultLogger), "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+	require.Equal(t, 1, callbacks)
+}
+
+func TestConfig_WithAllowList(t *testing.T) {
+	rule := redis_rate.PerMinute(2)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithAllowList("worker").
+		WithAllowList("cron")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 10; idx++ {
+		_, err := callAsUser(mw, "/a", "worker")
+		require.NoError(t, err)
+		_, err = callAsUser(mw, "/a", "cron")
+		require.NoError(t, err)
+	}
+	for idx := 0; idx < 2; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+	_, err := callAsUser(mw, "/a", "alice")
+	require.ErrorIs(t, err, ratelimit.ErrLimitExceed)
+}
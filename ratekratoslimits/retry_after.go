@@ -0,0 +1,34 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const retryAfterHeader = "Retry-After"
+
+// WithRetryAfterHeader 设置为 true 时被限流的响应带上 Retry-After 头，值是多少秒以后可以重试，向上取整且最少是1秒
+// http 请求写在响应头里，grpc 请求同时写在 header 和 trailer 的 metadata 里
+func (a *Config) WithRetryAfterHeader(enable bool) *Config {
+	a.retryAfterHeader = enable
+	return a
+}
+
+func setRetryAfterHeader(ctx context.Context, resetAfter time.Duration) {
+	tp, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return
+	}
+	seconds := strconv.Itoa(int(max(1, math.Ceil(resetAfter.Seconds()))))
+	tp.ReplyHeader().Set(retryAfterHeader, seconds)
+	if tp.Kind() == transport.KindGRPC {
+		//没有 grpc 的 stream 时会返回错误，比如单测里，这时只写在 ReplyHeader 里
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(retryAfterHeader, seconds))
+	}
+}
@@ -0,0 +1,62 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	kratoshttp "github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WithRetryAfterHeader(t *testing.T) {
+	rule := redis_rate.PerMinute(1)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewAll()).WithRetryAfterHeader(true)
+
+	srv := kratoshttp.NewServer(kratoshttp.Middleware(NewMiddleware(cfg, log.DefaultLogger)))
+	srv.Route("/").GET("/a", func(ctx kratoshttp.Context) error {
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return map[string]string{"message": "ok"}, nil
+		})
+		res, err := h(ctx, nil)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(http.StatusOK, res)
+	})
+	callOnce := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/a", nil)
+		req.Header.Set("X-User", "alice")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := callOnce()
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Retry-After"))
+
+	rec = callOnce()
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	seconds, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	require.Positive(t, seconds)
+	require.LessOrEqual(t, seconds, 60)
+
+	//grpc 请求写在 ReplyHeader 里
+	tp := kratosmock.NewGRPCTransport("/a").WithHeader("X-User", "alice")
+	_, err = NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(tp.NewContext(context.Background()), nil)
+	require.Error(t, err)
+	require.NotEmpty(t, tp.ReplyHeader().Get("Retry-After"))
+
+	//没有开启时不设置
+	tp, err = callAsUser(NewMiddleware(cfg.WithRetryAfterHeader(false), log.DefaultLogger), "/a", "alice")
+	require.Error(t, err)
+	require.Empty(t, tp.ReplyHeader().Get("Retry-After"))
+}
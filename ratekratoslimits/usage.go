@@ -0,0 +1,66 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/redis/go-redis/v9"
+	"github.com/yyle88/erero"
+)
+
+// redis_rate 把 GCRA 的 TAT 存在 "rate:" 前缀的 key 里，时间以 2017-01-01 为起点，这里保持一致才能读取
+const (
+	redisRatePrefix = "rate:"
+	redisRateEpoch  = 1483228800
+)
+
+// WithReadOnlyClient 设置只读的 redis 客户端，比如连接从库，仅用于 GetCurrentUsage 查询
+// 限流时执行的 lua 脚本既读又写，依然走 NewConfig 传入的 Limiter 对应的主库
+func (a *Config) WithReadOnlyClient(rdb redis.UniversalClient) *Config {
+	a.readOnlyClient = rdb
+	return a
+}
+
+// GetCurrentUsage 只读地查询某个 key 当前的限流状态，不消耗额度
+// 返回结果的 Remaining 是还能立即通过的请求数，ResetAfter 是恢复到初始状态需要的时间
+func (a *Config) GetCurrentUsage(ctx context.Context, key string) (*redis_rate.Result, error) {
+	if a.readOnlyClient == nil {
+		return nil, erero.New("rate_limit read only client is not set")
+	}
+	limit := *a.GetLimit()
+
+	value, err := a.readOnlyClient.Get(ctx, redisRatePrefix+key).Result()
+	if err != nil && !erero.Is(err, redis.Nil) {
+		return nil, erero.WithMessage(err, "rate_limit get usage redis exception")
+	}
+	serverTime, erx := a.readOnlyClient.Time(ctx).Result()
+	if erx != nil {
+		return nil, erero.WithMessage(erx, "rate_limit get time redis exception")
+	}
+	now := float64(serverTime.Unix()-redisRateEpoch) + float64(serverTime.Nanosecond())/1e9
+
+	tat := now
+	if value != "" {
+		res, erp := strconv.ParseFloat(value, 64)
+		if erp != nil {
+			return nil, erero.WithMessage(erp, "rate_limit parse usage value")
+		}
+		tat = math.Max(res, now)
+	}
+
+	emissionInterval := limit.Period.Seconds() / float64(limit.Rate)
+	burstOffset := emissionInterval * float64(limit.Burst)
+	remaining := int((now - (tat - burstOffset)) / emissionInterval)
+	remaining = max(0, min(remaining, limit.Burst))
+
+	return &redis_rate.Result{
+		Limit:      limit,
+		Allowed:    0,
+		Remaining:  remaining,
+		RetryAfter: -1,
+		ResetAfter: time.Duration((tat - now) * float64(time.Second)),
+	}, nil
+}
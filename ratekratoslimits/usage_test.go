@@ -0,0 +1,59 @@
+package utils_kratos_ratelimit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-redis/redis_rate/v10"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_GetCurrentUsage(t *testing.T) {
+	primary := miniredis.RunT(t)
+	replica := miniredis.RunT(t)
+	primaryClient := redis.NewClient(&redis.Options{Addr: primary.Addr()})
+	replicaClient := redis.NewClient(&redis.Options{Addr: replica.Addr()})
+	t.Cleanup(func() {
+		_ = primaryClient.Close()
+		_ = replicaClient.Close()
+	})
+
+	rule := redis_rate.PerMinute(10)
+	cfg := NewRedisConfig(redis_rate.NewLimiter(primaryClient), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a")).
+		WithReadOnlyClient(replicaClient)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	for idx := 0; idx < 3; idx++ {
+		_, err := callAsUser(mw, "/a", "alice")
+		require.NoError(t, err)
+	}
+	//限流只写主库
+	require.True(t, primary.Exists("rate:alice"))
+	require.False(t, replica.Exists("rate:alice"))
+
+	//查询只读从库，从库还没有数据时是初始状态
+	res, err := cfg.GetCurrentUsage(context.Background(), "alice")
+	require.NoError(t, err)
+	require.Equal(t, 10, res.Remaining)
+
+	//模拟主从同步以后，从库能查到已经使用的额度
+	value, err := primary.Get("rate:alice")
+	require.NoError(t, err)
+	require.NoError(t, replica.Set("rate:alice", value))
+
+	res, err = cfg.GetCurrentUsage(context.Background(), "alice")
+	require.NoError(t, err)
+	require.InDelta(t, 7, res.Remaining, 1)
+	require.Positive(t, res.ResetAfter)
+}
+
+func TestConfig_GetCurrentUsage_NoClient(t *testing.T) {
+	rule := redis_rate.PerMinute(10)
+	cfg := NewRedisConfig(newRateLimitBottle(t), &rule, parseUniqueCode, authkratosroutes.NewInclude("/a"))
+	_, err := cfg.GetCurrentUsage(context.Background(), "alice")
+	require.Error(t, err)
+}
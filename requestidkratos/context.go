@@ -0,0 +1,15 @@
+package requestidkratos
+
+import "context"
+
+type requestIDKey struct{}
+
+func SetRequestIDIntoContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// GetRequestID 在 handler 里获取请求 ID
+func GetRequestID(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok
+}
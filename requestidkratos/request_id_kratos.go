@@ -0,0 +1,121 @@
+package requestidkratos
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/google/uuid"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+)
+
+// 请求里带的 ID 只接受常见的字符，避免日志注入，长度也有限制
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+type Config struct {
+	field             string
+	selectPath        authkratosroutes.Matcher
+	generatorFunc     func() string
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher) *Config {
+	return &Config{
+		field:         "X-Request-ID",
+		selectPath:    selectPath,
+		generatorFunc: uuid.NewString,
+		enable:        true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable && a.field != ""
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印设置 request id 的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithFieldName 设置请求 ID 的请求头和响应头，默认是 X-Request-ID
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+// WithGeneratorFunc 设置生成请求 ID 的函数，默认是 UUID v4
+func (a *Config) WithGeneratorFunc(generatorFunc func() string) *Config {
+	a.generatorFunc = generatorFunc
+	return a
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new request_id middleware enable=%v field=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("request_id", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must set request id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip set request id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("request_id: cfg.enable=false pass")
+				return handleFunc(ctx, req)
+			}
+			if tp, ok := transport.FromServerContext(ctx); ok {
+				requestID := tp.RequestHeader().Get(cfg.field)
+				if requestID != "" && !requestIDPattern.MatchString(requestID) {
+					LOG.Debugf("request_id: invalid request id length=%d so generate new one", len(requestID))
+					requestID = ""
+				}
+				if requestID == "" {
+					requestID = cfg.generatorFunc()
+				}
+				tp.ReplyHeader().Set(cfg.field, requestID)
+				ctx = SetRequestIDIntoContext(ctx, requestID)
+			}
+			return handleFunc(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package requestidkratos
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	requestID, _ := GetRequestID(ctx)
+	return requestID, nil
+}
+
+func callOnce(cfg *Config, tp *kratosmock.Transport) string {
+	res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(tp.NewContext(context.Background()), nil)
+	if err != nil {
+		panic(err)
+	}
+	return res.(string)
+}
+
+func TestNewMiddleware(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll())
+
+	for _, newTransport := range []func(string) *kratosmock.Transport{kratosmock.NewHTTPTransport, kratosmock.NewGRPCTransport} {
+		tp := newTransport("/a").WithHeader("X-Request-ID", "req-123")
+		require.Equal(t, "req-123", callOnce(cfg, tp))
+		require.Equal(t, "req-123", tp.ReplyHeader().Get("X-Request-ID"))
+
+		tp = newTransport("/a")
+		requestID := callOnce(cfg, tp)
+		_, err := uuid.Parse(requestID)
+		require.NoError(t, err)
+		require.Equal(t, requestID, tp.ReplyHeader().Get("X-Request-ID"))
+
+		//不合法的 ID 重新生成
+		for _, invalid := range []string{"bad id\n", strings.Repeat("a", 200)} {
+			tp = newTransport("/a").WithHeader("X-Request-ID", invalid)
+			requestID = callOnce(cfg, tp)
+			require.NotEqual(t, invalid, requestID)
+			_, err = uuid.Parse(requestID)
+			require.NoError(t, err)
+		}
+	}
+
+	tp := kratosmock.NewHTTPTransport("/a")
+	require.Empty(t, callOnce(NewConfig(authkratosroutes.NewNone()), tp))
+	require.Empty(t, tp.ReplyHeader().Get("X-Request-ID"))
+}
+
+func TestConfig_WithGeneratorFunc(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithGeneratorFunc(func() string { return "custom-id" }).WithFieldName("X-Trace")
+	tp := kratosmock.NewGRPCTransport("/a")
+	require.Equal(t, "custom-id", callOnce(cfg, tp))
+	require.Equal(t, "custom-id", tp.ReplyHeader().Get("X-Trace"))
+}
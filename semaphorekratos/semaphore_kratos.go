@@ -0,0 +1,140 @@
+package semaphorekratos
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+	"github.com/yyle88/must"
+)
+
+// Config 限制同时处理中的请求数量，所有匹配的 operation 共享同一个信号量
+type Config struct {
+	selectPath        authkratosroutes.Matcher
+	semaphore         chan struct{}
+	acquireTimeout    time.Duration
+	enable            bool
+	structuredLogging bool
+}
+
+func NewConfig(selectPath authkratosroutes.Matcher, maxConcurrent int) *Config {
+	must.TRUE(maxConcurrent > 0)
+	return &Config{
+		selectPath: selectPath,
+		semaphore:  make(chan struct{}, maxConcurrent),
+		enable:     true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印是否拿到并发名额的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithAcquireTimeout 设置等待信号量的最长时间，默认是 0 即拿不到时立即拒绝
+func (a *Config) WithAcquireTimeout(d time.Duration) *Config {
+	must.TRUE(d >= 0)
+	a.acquireTimeout = d
+	return a
+}
+
+// GetCurrentConcurrency 返回当前处理中的请求数量，用于监控
+func (a *Config) GetCurrentConcurrency() int {
+	return len(a.semaphore)
+}
+
+// acquire 拿到信号量时返回 true，等待超时或者请求取消时返回 false
+func (a *Config) acquire(ctx context.Context) bool {
+	select {
+	case a.semaphore <- struct{}{}:
+		return true
+	default:
+	}
+	if a.acquireTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(a.acquireTimeout)
+	defer timer.Stop()
+	select {
+	case a.semaphore <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (a *Config) release() {
+	<-a.semaphore
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new semaphore middleware enable=%v max_concurrent=%v acquire_timeout=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cap(cfg.semaphore),
+		cfg.acquireTimeout,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("semaphore", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must limit concurrency", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip limit concurrency", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("semaphore: cfg.enable=false anonymous pass")
+				return handleFunc(ctx, req)
+			}
+			if !cfg.acquire(ctx) {
+				LOG.Warnf("semaphore: concurrency=%v exceeds so reject requests", cfg.GetCurrentConcurrency())
+				return nil, errors.New(http.StatusServiceUnavailable, "CONCURRENCY_LIMIT_EXCEEDED", "semaphore: concurrency limit exceeded")
+			}
+			defer cfg.release()
+			return handleFunc(ctx, req)
+		}
+	}
+}
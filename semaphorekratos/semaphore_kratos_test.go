@@ -0,0 +1,137 @@
+package semaphorekratos
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func callOnce(mw middleware.Middleware, handleFunc middleware.Handler, operation string) error {
+	ctx := kratosmock.NewHTTPTransport(operation).NewContext(context.Background())
+	_, err := mw(handleFunc)(ctx, nil)
+	return err
+}
+
+func TestNewMiddleware(t *testing.T) {
+	const maxConcurrent = 3
+	const total = 10
+
+	cfg := NewConfig(authkratosroutes.NewAll(), maxConcurrent)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//前 maxConcurrent 个请求进入 handler 后阻塞，直到其余请求都被拒绝
+	blocking := make(chan struct{})
+	var entered sync.WaitGroup
+	entered.Add(maxConcurrent)
+	var inFlight, peak atomic.Int64
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		current := inFlight.Add(1)
+		for {
+			value := peak.Load()
+			if current <= value || peak.CompareAndSwap(value, current) {
+				break
+			}
+		}
+		entered.Done()
+		<-blocking
+		inFlight.Add(-1)
+		return "ok", nil
+	}
+
+	var erks = make(chan error, total)
+	var wg sync.WaitGroup
+	for idx := 0; idx < maxConcurrent; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			erks <- callOnce(mw, handleFunc, "/a")
+		}()
+	}
+	entered.Wait()
+	require.Equal(t, maxConcurrent, cfg.GetCurrentConcurrency())
+
+	for idx := maxConcurrent; idx < total; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			erks <- callOnce(mw, handleFunc, "/a")
+		}()
+	}
+	//被拒绝的请求不进入 handler，等它们全部返回后再放行阻塞的请求
+	var rejected int
+	for idx := maxConcurrent; idx < total; idx++ {
+		erk := <-erks
+		require.Error(t, erk)
+		require.Equal(t, "CONCURRENCY_LIMIT_EXCEEDED", errors.Reason(erk))
+		require.Equal(t, http.StatusServiceUnavailable, int(errors.Code(erk)))
+		rejected++
+	}
+	close(blocking)
+	wg.Wait()
+	close(erks)
+
+	var passed int
+	for erk := range erks {
+		require.NoError(t, erk)
+		passed++
+	}
+	require.Equal(t, maxConcurrent, passed)
+	require.Equal(t, total-maxConcurrent, rejected)
+	require.Equal(t, int64(maxConcurrent), peak.Load())
+	require.Equal(t, 0, cfg.GetCurrentConcurrency())
+}
+
+func TestConfig_WithAcquireTimeout(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll(), 1).WithAcquireTimeout(time.Second)
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	//等待期间信号量被释放，第二个请求能拿到
+	release := make(chan struct{})
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return "ok", nil
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		require.NoError(t, callOnce(mw, handleFunc, "/a"))
+	}()
+	require.Eventually(t, func() bool { return cfg.GetCurrentConcurrency() == 1 }, time.Second, time.Millisecond)
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	require.NoError(t, callOnce(mw, handleFunc, "/a"))
+	wg.Wait()
+
+	//等待超时
+	cfg = NewConfig(authkratosroutes.NewAll(), 1).WithAcquireTimeout(20 * time.Millisecond)
+	cfg.semaphore <- struct{}{}
+	startTime := time.Now()
+	erk := callOnce(NewMiddleware(cfg, log.DefaultLogger), handleFunc, "/a")
+	require.Equal(t, "CONCURRENCY_LIMIT_EXCEEDED", errors.Reason(erk))
+	require.GreaterOrEqual(t, time.Since(startTime), 20*time.Millisecond)
+}
+
+func TestNewMiddleware_Skip(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"), 1)
+	cfg.semaphore <- struct{}{}
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	require.Error(t, callOnce(mw, handleFunc, "/a"))
+	require.NoError(t, callOnce(mw, handleFunc, "/b"))
+}
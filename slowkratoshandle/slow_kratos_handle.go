@@ -2,19 +2,29 @@ package slowkratoshandle
 
 import (
 	"context"
+	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
 	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
 	"github.com/orzkratos/authkratos/internal/utils"
 )
 
 type Config struct {
-	fastTimeoutGap time.Duration //快速超时的时间
-	fastOperations []authkratosroutes.Path
-	slowOperations []authkratosroutes.Path
+	fastTimeoutGap    time.Duration //快速超时的时间
+	fastOperations    []authkratosroutes.Path
+	slowOperations    []authkratosroutes.Path
+	skipIfHasDeadline bool
+	timeoutHeader     string
+	minimumTimeout    time.Duration
+	structuredLogging bool
 }
 
 func NewConfig(
@@ -29,17 +39,87 @@ func NewConfig(
 	}
 }
 
+// WithStructuredLogging 按请求打印延迟耗时的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithSkipIfAlreadyHasDeadline 设置为 true 时，假如上下文里已经有超时时间（比如服务端配置了 http.Timeout）就不再设置快速超时
+func (a *Config) WithSkipIfAlreadyHasDeadline(skip bool) *Config {
+	a.skipIfHasDeadline = skip
+	return a
+}
+
+// WithTimeoutFromHeader 从请求头读取客户端期望的超时时间，比如 "30s"，只能比 fastTimeoutGap 更短，更长时仍使用 fastTimeoutGap
+func (a *Config) WithTimeoutFromHeader(headerName string) *Config {
+	a.timeoutHeader = headerName
+	return a
+}
+
+// WithMinimumTimeout 请求进来时剩余的超时时间比这个还短就直接拒绝，避免外层设置的超时太短导致快速超时不起作用
+func (a *Config) WithMinimumTimeout(d time.Duration) *Config {
+	a.minimumTimeout = d
+	return a
+}
+
+// getTimeout 返回这个请求的快速超时时间，请求头里的时间不合法时忽略
+func (a *Config) getTimeout(ctx context.Context, LOG *log.Helper) time.Duration {
+	if a.timeoutHeader == "" {
+		return a.fastTimeoutGap
+	}
+	tsp, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return a.fastTimeoutGap
+	}
+	value := tsp.RequestHeader().Get(a.timeoutHeader)
+	if value == "" {
+		return a.fastTimeoutGap
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		LOG.Debugf("slow_fast_middleware header %s=%q is invalid so ignore", a.timeoutHeader, value)
+		return a.fastTimeoutGap
+	}
+	timeout := min(parsed, a.fastTimeoutGap)
+	LOG.Debugf("slow_fast_middleware header %s=%v fast_timeout=%v so use timeout=%v", a.timeoutHeader, parsed, a.fastTimeoutGap, timeout)
+	return timeout
+}
+
+// TimeoutStats 统计走快速超时的请求数和其中超时的请求数，便于运维观察超时的比例
+type TimeoutStats struct {
+	Total    atomic.Int64
+	TimedOut atomic.Int64
+}
+
+// TimeoutRate 超时的比例，没有请求时返回0
+func (s *TimeoutStats) TimeoutRate() float64 {
+	total := s.Total.Load()
+	if total == 0 {
+		return 0
+	}
+	return float64(s.TimedOut.Load()) / float64(total)
+}
+
 // NewMiddleware 有时接口分为快速返回和耗时返回两种，我们可以单独设置它们的timeout时间，否则假如把超时都设置为10分钟，则某些小接口卡住时也不行
 func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	mw, _ := NewMiddlewareWithStats(cfg, LOGGER)
+	return mw
+}
+
+// NewMiddlewareWithStats 和 NewMiddleware 相同，同时返回快速超时的统计信息
+func NewMiddlewareWithStats(cfg *Config, LOGGER log.Logger) (middleware.Middleware, *TimeoutStats) {
 	LOG := log.NewHelper(LOGGER)
 	LOG.Infof(
-		"new slow_fast middleware slow=%v fast=%v fast_timeout=%v",
+		"new slow_fast middleware slow=%v fast=%v fast_timeout=%v version=%v",
 		len(cfg.slowOperations),
 		len(cfg.fastOperations),
 		cfg.fastTimeoutGap,
+		authkratos.Version(),
 	)
 
-	return selector.Server(middlewareFunc(cfg)).Match(matchFunc(cfg, LOGGER)).Build()
+	stats := &TimeoutStats{}
+	return selector.Server(structlog.Wrap("slow_fast", cfg.structuredLogging, middlewareFunc(cfg, stats, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build(), stats
 }
 
 func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
@@ -61,13 +141,42 @@ func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
 	}
 }
 
-func middlewareFunc(cfg *Config) middleware.Middleware {
+func middlewareFunc(cfg *Config, stats *TimeoutStats, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
 	return func(handleFunc middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
-			//设置新超时时间，因此需要外面的超时时间更长些，选择部分接口设置快速超时
-			ctx, can := context.WithTimeout(ctx, cfg.fastTimeoutGap)
-			defer can()
-			return handleFunc(ctx, req)
+			if deadline, ok := ctx.Deadline(); ok && cfg.minimumTimeout > 0 {
+				if remaining := time.Until(deadline); remaining < cfg.minimumTimeout {
+					LOG.Warnf("slow_fast_middleware remaining=%v minimum_timeout=%v so reject requests", remaining, cfg.minimumTimeout)
+					return nil, errors.New(http.StatusServiceUnavailable, "DEADLINE_TOO_SHORT", "slow_fast_middleware: deadline too short")
+				}
+			}
+			stats.Total.Add(1)
+			if _, ok := ctx.Deadline(); ok && cfg.skipIfHasDeadline {
+				LOG.Debugf("slow_fast_middleware context already has deadline so skip fast timeout")
+			} else {
+				//设置新超时时间，因此需要外面的超时时间更长些，选择部分接口设置快速超时
+				timeout := cfg.getTimeout(ctx, LOG)
+				var can context.CancelFunc
+				ctx, can = context.WithTimeout(ctx, timeout)
+				defer can()
+				ctx = context.WithValue(ctx, configuredTimeoutKey{}, timeout)
+			}
+			resp, err := handleFunc(ctx, req)
+			if errors.Is(err, context.DeadlineExceeded) {
+				stats.TimedOut.Add(1)
+			}
+			return resp, err
 		}
 	}
 }
+
+type configuredTimeoutKey struct{}
+
+// GetConfiguredTimeout 获取中间件设置的快速超时时间，注意不是剩余时间，剩余时间请用 ctx.Deadline() 计算
+// 没有经过快速超时的请求返回 (0, false)
+func GetConfiguredTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(configuredTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
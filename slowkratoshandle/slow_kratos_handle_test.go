@@ -1,9 +1,165 @@
 package slowkratoshandle
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMain(m *testing.M) {
 	m.Run()
 }
+
+func TestNewMiddlewareWithStats(t *testing.T) {
+	cfg := NewConfig(20*time.Millisecond, authkratosroutes.Paths{"/fast"}, authkratosroutes.Paths{"/slow"})
+	mw, stats := NewMiddlewareWithStats(cfg, log.DefaultLogger)
+
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if req.(bool) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "ok", nil
+	}
+
+	for idx := 0; idx < 10; idx++ {
+		ctx := kratosmock.NewHTTPTransport("/fast").NewContext(context.Background())
+		_, _ = mw(handleFunc)(ctx, idx < 3)
+	}
+	//慢接口不走快速超时，因此不计数
+	ctx := kratosmock.NewHTTPTransport("/slow").NewContext(context.Background())
+	_, _ = mw(handleFunc)(ctx, false)
+
+	require.Equal(t, int64(10), stats.Total.Load())
+	require.Equal(t, int64(3), stats.TimedOut.Load())
+	require.InDelta(t, 0.3, stats.TimeoutRate(), 0.0001)
+}
+
+func TestGetConfiguredTimeout(t *testing.T) {
+	cfg := NewConfig(time.Second, authkratosroutes.Paths{"/fast"}, authkratosroutes.Paths{"/slow"})
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		timeout, ok := GetConfiguredTimeout(ctx)
+		return []interface{}{timeout, ok}, nil
+	}
+
+	ctx := kratosmock.NewHTTPTransport("/fast").NewContext(context.Background())
+	res, err := mw(handleFunc)(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{time.Second, true}, res)
+
+	ctx = kratosmock.NewHTTPTransport("/slow").NewContext(context.Background())
+	res, err = mw(handleFunc)(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{time.Duration(0), false}, res)
+}
+
+func TestConfig_WithSkipIfAlreadyHasDeadline(t *testing.T) {
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, _ := ctx.Deadline()
+		return deadline, nil
+	}
+	callWithDeadline := func(cfg *Config, outerTimeout time.Duration) time.Duration {
+		startTime := time.Now()
+		ctx := context.Background()
+		if outerTimeout > 0 {
+			var can context.CancelFunc
+			ctx, can = context.WithTimeout(ctx, outerTimeout)
+			defer can()
+		}
+		ctx = kratosmock.NewHTTPTransport("/fast").NewContext(ctx)
+		res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(ctx, nil)
+		require.NoError(t, err)
+		return res.(time.Time).Sub(startTime)
+	}
+	newConfig := func() *Config {
+		return NewConfig(time.Second, authkratosroutes.Paths{"/fast"}, nil)
+	}
+
+	//不跳过时取两者的最小值
+	require.InDelta(t, time.Second, callWithDeadline(newConfig(), time.Minute), float64(100*time.Millisecond))
+	require.InDelta(t, time.Second, callWithDeadline(newConfig(), 0), float64(100*time.Millisecond))
+
+	//跳过时保留外面的超时时间
+	cfg := newConfig().WithSkipIfAlreadyHasDeadline(true)
+	require.InDelta(t, time.Minute, callWithDeadline(cfg, time.Minute), float64(100*time.Millisecond))
+	require.InDelta(t, time.Second, callWithDeadline(cfg, 0), float64(100*time.Millisecond))
+}
+
+func TestConfig_WithTimeoutFromHeader(t *testing.T) {
+	cfg := NewConfig(time.Second, authkratosroutes.Paths{"/fast"}, nil).WithTimeoutFromHeader("X-Timeout-Override")
+	mw := NewMiddleware(cfg, log.DefaultLogger)
+
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		timeout, _ := GetConfiguredTimeout(ctx)
+		return timeout, nil
+	}
+	callWithHeader := func(value string) time.Duration {
+		tp := kratosmock.NewGRPCTransport("/fast")
+		if value != "" {
+			tp = tp.WithHeader("X-Timeout-Override", value)
+		}
+		res, err := mw(handleFunc)(tp.NewContext(context.Background()), nil)
+		require.NoError(t, err)
+		return res.(time.Duration)
+	}
+
+	//客户端只能缩短超时时间，不能延长
+	require.Equal(t, 200*time.Millisecond, callWithHeader("200ms"))
+	require.Equal(t, time.Second, callWithHeader("30s"))
+	require.Equal(t, time.Second, callWithHeader("not-duration"))
+	require.Equal(t, time.Second, callWithHeader("-1s"))
+	require.Equal(t, time.Second, callWithHeader(""))
+
+	//缩短后的超时时间确实生效
+	ctx := kratosmock.NewHTTPTransport("/fast").WithHeader("X-Timeout-Override", "20ms").NewContext(context.Background())
+	startTime := time.Now()
+	_, err := mw(func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})(ctx, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(startTime), 500*time.Millisecond)
+}
+
+func TestConfig_WithMinimumTimeout(t *testing.T) {
+	cfg := NewConfig(time.Second, authkratosroutes.Paths{"/fast"}, nil).WithMinimumTimeout(50 * time.Millisecond)
+	mw, stats := NewMiddlewareWithStats(cfg, log.DefaultLogger)
+
+	var called bool
+	handleFunc := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return "ok", nil
+	}
+	callWithTimeout := func(outerTimeout time.Duration) error {
+		called = false
+		ctx := context.Background()
+		if outerTimeout > 0 {
+			var can context.CancelFunc
+			ctx, can = context.WithTimeout(ctx, outerTimeout)
+			defer can()
+		}
+		ctx = kratosmock.NewHTTPTransport("/fast").NewContext(ctx)
+		_, err := mw(handleFunc)(ctx, nil)
+		return err
+	}
+
+	//快要超时的请求直接拒绝，不进入 handler
+	erk := callWithTimeout(time.Millisecond)
+	require.Equal(t, "DEADLINE_TOO_SHORT", errors.Reason(erk))
+	require.Equal(t, 503, int(errors.Code(erk)))
+	require.False(t, called)
+	require.Equal(t, int64(0), stats.Total.Load())
+
+	require.NoError(t, callWithTimeout(time.Minute))
+	require.True(t, called)
+	require.NoError(t, callWithTimeout(0))
+	require.True(t, called)
+}
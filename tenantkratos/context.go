@@ -0,0 +1,15 @@
+package tenantkratos
+
+import "context"
+
+type tenantIDKey struct{}
+
+func SetTenantIDIntoContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey{}, tenantID)
+}
+
+// GetTenantID 在 handler 里获取租户 ID，比如拼接到数据库查询条件和缓存 key 里
+func GetTenantID(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantIDKey{}).(string)
+	return tenantID, ok
+}
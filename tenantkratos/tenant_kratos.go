@@ -0,0 +1,155 @@
+package tenantkratos
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/authkratos"
+	"github.com/orzkratos/authkratos/authkratosctx"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/structlog"
+)
+
+// 租户 ID 默认只接受常见的字符，避免拼接到缓存 key 或者日志里时出问题
+var defaultTenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+type Config struct {
+	field             string
+	metadataKey       string
+	selectPath        authkratosroutes.Matcher
+	pattern           *regexp.Regexp
+	required          bool
+	enable            bool
+	structuredLogging bool
+}
+
+// NewConfig 创建配置，租户 ID 优先取认证通过的 UserInfo.Metadata["tenant_id"]，没有时取请求头 X-Tenant-ID
+func NewConfig(selectPath authkratosroutes.Matcher) *Config {
+	return &Config{
+		field:       "X-Tenant-ID",
+		metadataKey: "tenant_id",
+		selectPath:  selectPath,
+		pattern:     defaultTenantIDPattern,
+		required:    true,
+		enable:      true,
+	}
+}
+
+func (a *Config) SetEnable(enable bool) {
+	a.enable = enable
+}
+
+func (a *Config) IsEnable() bool {
+	if a != nil {
+		return a.enable
+	}
+	return false
+}
+
+// WithStructuredLogging 按请求打印租户识别结果的结构化 debug 日志，默认不打印
+func (a *Config) WithStructuredLogging(structuredLogging bool) *Config {
+	a.structuredLogging = structuredLogging
+	return a
+}
+
+// WithFieldName 设置取租户 ID 的请求头，默认是 X-Tenant-ID，设置为空时不从请求头取
+func (a *Config) WithFieldName(field string) *Config {
+	a.field = field
+	return a
+}
+
+// WithMetadataKey 设置从 UserInfo.Metadata 里取租户 ID 的 key，默认是 tenant_id，设置为空时不从用户信息取
+func (a *Config) WithMetadataKey(metadataKey string) *Config {
+	a.metadataKey = metadataKey
+	return a
+}
+
+// WithPattern 设置租户 ID 的格式，默认只允许字母、数字、下划线和中划线，最长 64 个字符
+func (a *Config) WithPattern(pattern string) *Config {
+	a.pattern = regexp.MustCompile(pattern)
+	return a
+}
+
+// WithRequired 设置为 false 时没有租户 ID 的请求也能通过，默认是必须有租户 ID
+func (a *Config) WithRequired(required bool) *Config {
+	a.required = required
+	return a
+}
+
+func NewMiddleware(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+	LOG.Infof(
+		"new tenant middleware enable=%v field=%v metadata_key=%v required=%v include=%v operations=%v version=%v",
+		cfg.IsEnable(),
+		cfg.field,
+		cfg.metadataKey,
+		cfg.required,
+		authkratosroutes.SideOf(cfg.selectPath),
+		authkratosroutes.LenOf(cfg.selectPath),
+		authkratos.Version(),
+	)
+
+	return selector.Server(structlog.Wrap("tenant", cfg.structuredLogging, middlewareFunc(cfg, LOGGER), LOGGER)).Match(matchFunc(cfg, LOGGER)).Build()
+}
+
+func matchFunc(cfg *Config, LOGGER log.Logger) selector.MatchFunc {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(ctx context.Context, operation string) bool {
+		if !cfg.IsEnable() {
+			return false
+		}
+		match := cfg.selectPath.Match(operation)
+		if match {
+			LOG.Debugf("operation=%s include=%v match=%v must set tenant id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		} else {
+			LOG.Debugf("operation=%s include=%v match=%v skip set tenant id", operation, authkratosroutes.SideOf(cfg.selectPath), match)
+		}
+		return match
+	}
+}
+
+func middlewareFunc(cfg *Config, LOGGER log.Logger) middleware.Middleware {
+	LOG := log.NewHelper(LOGGER)
+
+	return func(handleFunc middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if !cfg.IsEnable() {
+				LOG.Infof("tenant: cfg.enable=false pass")
+				return handleFunc(ctx, req)
+			}
+			var headerTenantID string
+			if tp, ok := transport.FromServerContext(ctx); ok && cfg.field != "" {
+				headerTenantID = tp.RequestHeader().Get(cfg.field)
+			}
+			var tenantID = headerTenantID
+			if userInfo, ok := authkratosctx.GetUserInfo(ctx); ok && cfg.metadataKey != "" {
+				if metaTenantID := userInfo.Metadata[cfg.metadataKey]; metaTenantID != "" {
+					//认证通过的租户 ID 更可信，请求头里的租户 ID 和它不同时拒绝，避免跨租户访问
+					if headerTenantID != "" && headerTenantID != metaTenantID {
+						LOG.Infof("tenant: username:%v tenant id mismatch not pass", userInfo.Username)
+						return nil, errors.Forbidden("TENANT_ID_MISMATCH", "tenant: tenant id is not match with user")
+					}
+					tenantID = metaTenantID
+				}
+			}
+			if tenantID == "" {
+				if cfg.required {
+					return nil, errors.BadRequest("MISSING_TENANT_ID", "tenant: tenant id is missing")
+				}
+				return handleFunc(ctx, req)
+			}
+			if !cfg.pattern.MatchString(tenantID) {
+				LOG.Debugf("tenant: invalid tenant id length=%d", len(tenantID))
+				return nil, errors.BadRequest("INVALID_TENANT_ID", "tenant: tenant id is invalid")
+			}
+			ctx = SetTenantIDIntoContext(ctx, tenantID)
+			return handleFunc(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tenantkratos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/orzkratos/authkratos/authkratosctx"
+	"github.com/orzkratos/authkratos/authkratosroutes"
+	"github.com/orzkratos/authkratos/internal/kratosmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func handleFunc(ctx context.Context, req interface{}) (interface{}, error) {
+	tenantID, _ := GetTenantID(ctx)
+	return tenantID, nil
+}
+
+// callOnce 返回 handler 收到的租户 ID，metaTenantID 不为空时模拟认证通过并带有租户 ID 的用户信息
+func callOnce(cfg *Config, tp *kratosmock.Transport, metaTenantID string) (string, *errors.Error) {
+	ctx := tp.NewContext(context.Background())
+	if metaTenantID != "" {
+		ctx = authkratosctx.SetUserInfoIntoContext(ctx, authkratosctx.UserInfo{
+			Username: "alice",
+			Metadata: map[string]string{"tenant_id": metaTenantID},
+		})
+	}
+	res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(ctx, nil)
+	if err != nil {
+		return "", errors.FromError(err)
+	}
+	return res.(string), nil
+}
+
+func TestNewMiddleware(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewInclude("/a"))
+
+	for _, newTransport := range []func(string) *kratosmock.Transport{kratosmock.NewHTTPTransport, kratosmock.NewGRPCTransport} {
+		tenantID, erk := callOnce(cfg, newTransport("/a").WithHeader("X-Tenant-ID", "tenant-1"), "")
+		require.Nil(t, erk)
+		require.Equal(t, "tenant-1", tenantID)
+
+		tenantID, erk = callOnce(cfg, newTransport("/a"), "tenant-2")
+		require.Nil(t, erk)
+		require.Equal(t, "tenant-2", tenantID)
+
+		tenantID, erk = callOnce(cfg, newTransport("/a").WithHeader("X-Tenant-ID", "tenant-2"), "tenant-2")
+		require.Nil(t, erk)
+		require.Equal(t, "tenant-2", tenantID)
+
+		_, erk = callOnce(cfg, newTransport("/a").WithHeader("X-Tenant-ID", "tenant-1"), "tenant-2")
+		require.True(t, errors.IsForbidden(erk))
+		require.Equal(t, "TENANT_ID_MISMATCH", erk.Reason)
+
+		_, erk = callOnce(cfg, newTransport("/a"), "")
+		require.True(t, errors.IsBadRequest(erk))
+		require.Equal(t, "MISSING_TENANT_ID", erk.Reason)
+
+		_, erk = callOnce(cfg, newTransport("/a").WithHeader("X-Tenant-ID", "bad tenant"), "")
+		require.True(t, errors.IsBadRequest(erk))
+		require.Equal(t, "INVALID_TENANT_ID", erk.Reason)
+
+		tenantID, erk = callOnce(cfg, newTransport("/b"), "")
+		require.Nil(t, erk)
+		require.Equal(t, "", tenantID)
+	}
+}
+
+func TestConfig_WithRequired(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithRequired(false)
+	tenantID, erk := callOnce(cfg, kratosmock.NewHTTPTransport("/a"), "")
+	require.Nil(t, erk)
+	require.Equal(t, "", tenantID)
+}
+
+func TestConfig_WithPattern(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithPattern(`^t[0-9]+$`).WithFieldName("X-Org")
+	tenantID, erk := callOnce(cfg, kratosmock.NewHTTPTransport("/a").WithHeader("X-Org", "t100"), "")
+	require.Nil(t, erk)
+	require.Equal(t, "t100", tenantID)
+
+	_, erk = callOnce(cfg, kratosmock.NewHTTPTransport("/a").WithHeader("X-Org", "tenant-1"), "")
+	require.True(t, errors.IsBadRequest(erk))
+}
+
+func TestConfig_WithMetadataKey(t *testing.T) {
+	cfg := NewConfig(authkratosroutes.NewAll()).WithMetadataKey("org")
+	ctx := authkratosctx.SetUserInfoIntoContext(kratosmock.NewHTTPTransport("/a").NewContext(context.Background()), authkratosctx.UserInfo{
+		Username: "alice",
+		Metadata: map[string]string{"org": "org-1", "tenant_id": "tenant-1"},
+	})
+	res, err := NewMiddleware(cfg, log.DefaultLogger)(handleFunc)(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, "org-1", res)
+}
@@ -0,0 +1,39 @@
+package authkratos
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version 发布新版本打 tag 时同时修改这里，和 go.mod 引用的版本相同
+const version = "v0.1.0"
+
+// Version 返回当前包的版本号，各个中间件创建时都会打印，便于排查依赖了不同版本的问题
+func Version() string {
+	return version
+}
+
+// BuildInfo 编译时的信息
+type BuildInfo struct {
+	Version   string   //当前包的版本号
+	GoVersion string   //编译使用的 go 版本
+	BuildTags []string //编译时的 -tags 参数，比如 otel
+}
+
+// GetBuildInfo 返回编译时的信息，读取不到 debug.ReadBuildInfo 时 GoVersion 使用运行时的版本
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = buildInfo.GoVersion
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "-tags" && setting.Value != "" {
+				info.BuildTags = strings.Split(setting.Value, ",")
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,21 @@
+package authkratos
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersion(t *testing.T) {
+	require.NotEmpty(t, Version())
+	require.Regexp(t, regexp.MustCompile(`^v(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?$`), Version())
+}
+
+func TestGetBuildInfo(t *testing.T) {
+	info := GetBuildInfo()
+	t.Log(info)
+	require.Equal(t, Version(), info.Version)
+	require.True(t, strings.HasPrefix(info.GoVersion, "go"))
+}